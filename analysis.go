@@ -0,0 +1,477 @@
+package awn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// frostMaxTempf is the default air temperature, in degrees Fahrenheit, at or below
+	// which frost can form on exposed surfaces. Surfaces radiate heat on clear, calm
+	// nights and can sit several degrees below the air temperature, which is why this
+	// is above the freezing point.
+	frostMaxTempf = 36.0
+
+	// frostMaxWindspeedmph is the default wind speed, in miles per hour, at or below
+	// which the air is considered calm enough for frost to settle.
+	frostMaxWindspeedmph = 5.0
+
+	// frostMinHumidity is the default relative humidity, as a percentage, at or above
+	// which there is enough moisture in the air for frost to form.
+	frostMinHumidity = 80
+
+	// sparklineBlocks are the characters used to draw a sparkline, from lowest to highest.
+	sparklineBlocks = "▁▂▃▄▅▆▇█"
+
+	// pressureTrendThresholdInHg is the default change in relative pressure, in inches of
+	// mercury, at or beyond which the pressure is considered to be rising or falling.
+	// Over the usual 3-hour window, smaller changes are within the daily swing of the
+	// pressure.
+	pressureTrendThresholdInHg = 0.02
+)
+
+// The trends that are returned by PressureTrend.
+const (
+	PressureRising  = "rising"
+	PressureFalling = "falling"
+	PressureSteady  = "steady"
+)
+
+// BatteryEvent is a struct that describes a change in the battery state of a sensor.
+// Sensor is the JSON name of the battery field (i.e. "battout") and Low reports whether
+// the battery went low (true) or back to OK (false) at Date.
+type BatteryEvent struct {
+	Date   time.Time `json:"date"`
+	Low    bool      `json:"low"`
+	Sensor string    `json:"sensor"`
+}
+
+// FrostThresholds is a struct that describes the conditions that are considered to be
+// favorable for frost. A record is flagged when the temperature is at or below MaxTempf,
+// the wind speed is at or below MaxWindspeedmph and the humidity is at or above
+// MinHumidity.
+type FrostThresholds struct {
+	MaxTempf        float64 `json:"maxTempf"`
+	MaxWindspeedmph float64 `json:"maxWindspeedmph"`
+	MinHumidity     int     `json:"minHumidity"`
+}
+
+// FrostEvent is a struct that describes a single record with frost-favorable conditions.
+type FrostEvent struct {
+	Date         time.Time `json:"date"`
+	Humidity     int       `json:"humidity"`
+	Tempf        float64   `json:"tempf"`
+	Windspeedmph float64   `json:"windspeedmph"`
+}
+
+// DefaultFrostThresholds is a public function that returns the FrostThresholds used by
+// FrostEvents: 36°F or colder, winds of 5 mph or less and a humidity of 80% or more.
+func DefaultFrostThresholds() FrostThresholds {
+	return FrostThresholds{
+		MaxTempf:        frostMaxTempf,
+		MaxWindspeedmph: frostMaxWindspeedmph,
+		MinHumidity:     frostMinHumidity,
+	}
+}
+
+// FrostEvents is a public method that returns a FrostEvent for every record in the
+// DeviceDataResponse that has frost-favorable conditions, using the thresholds from
+// DefaultFrostThresholds. This is a heuristic and is meant to be used as an early warning
+// for gardeners, not as a forecast.
+//
+// Basic Usage:
+//
+//	events := data.FrostEvents()
+func (d DeviceDataResponse) FrostEvents() []FrostEvent {
+	return d.FrostEventsWithThresholds(DefaultFrostThresholds())
+}
+
+// FrostEventsWithThresholds is a public method that works like FrostEvents, but allows
+// the caller to override the thresholds that are used to flag a record.
+//
+// Basic Usage:
+//
+//	thresholds := awn.DefaultFrostThresholds()
+//	thresholds.MaxTempf = 34
+//	events := data.FrostEventsWithThresholds(thresholds)
+func (d DeviceDataResponse) FrostEventsWithThresholds(t FrostThresholds) []FrostEvent {
+	var events []FrostEvent
+
+	for _, record := range d {
+		if record.Tempf > t.MaxTempf ||
+			record.Windspeedmph > t.MaxWindspeedmph ||
+			record.Humidity < t.MinHumidity {
+			continue
+		}
+
+		events = append(events, FrostEvent{
+			Date:         record.Date,
+			Humidity:     record.Humidity,
+			Tempf:        record.Tempf,
+			Windspeedmph: record.Windspeedmph,
+		})
+	}
+
+	return events
+}
+
+// chronological is a private helper function that returns a copy of the records in d,
+// sorted from oldest to newest. The API returns records newest-first.
+func (d DeviceDataResponse) chronological() DeviceDataResponse {
+	sorted := make(DeviceDataResponse, len(d))
+	copy(sorted, d)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Dateutc < sorted[j].Dateutc
+	})
+
+	return sorted
+}
+
+// fieldValues is a private helper function that returns the value of the numeric field
+// with the given JSON name (i.e. "tempf") for every record in d, in the same order. It
+// returns ErrUnknownField if the field does not exist or is not numeric.
+func (d DeviceDataResponse) fieldValues(field string) ([]float64, error) {
+	index, ok := weatherRecordFields()[field]
+	if !ok {
+		return nil, ErrUnknownField.withDetail("%q", field)
+	}
+
+	kind := reflect.TypeOf(WeatherRecord{}).Field(index).Type.Kind() //nolint:exhaustruct
+	if kind != reflect.Float64 && kind != reflect.Int && kind != reflect.Int64 {
+		return nil, ErrUnknownField.withDetail("%q is not numeric", field)
+	}
+
+	values := make([]float64, len(d))
+
+	for i := range d {
+		value := reflect.ValueOf(d[i]).Field(index)
+		if kind == reflect.Float64 {
+			values[i] = value.Float()
+		} else {
+			values[i] = float64(value.Int())
+		}
+	}
+
+	return values, nil
+}
+
+// Sparkline is a public method that renders the numeric field with the given JSON name
+// (i.e. "tempf") as a Unicode sparkline, from the oldest record on the left to the
+// newest on the right. When there are more records than width, they are split into
+// width buckets and each bucket is drawn as its average, so the result is exactly width
+// characters long. When there are fewer records, each record gets one character. The
+// lowest value is drawn as ▁ and the highest as █.
+//
+// Basic Usage:
+//
+//	line, err := data.Sparkline("tempf", 40)
+func (d DeviceDataResponse) Sparkline(field string, width int) (string, error) {
+	if width < 1 {
+		return "", fmt.Errorf("sparkline width must be at least 1, got %v", width)
+	}
+
+	if len(d) == 0 {
+		return "", errors.New("no records to draw a sparkline from")
+	}
+
+	values, err := d.chronological().fieldValues(field)
+	if err != nil {
+		return "", err
+	}
+
+	if len(values) > width {
+		values = downsample(values, width)
+	}
+
+	low, high := values[0], values[0]
+	for _, value := range values {
+		low = min(low, value)
+		high = max(high, value)
+	}
+
+	blocks := []rune(sparklineBlocks)
+
+	var line strings.Builder
+
+	for _, value := range values {
+		level := 0
+		if high > low {
+			level = int((value - low) / (high - low) * float64(len(blocks)-1))
+		}
+		line.WriteRune(blocks[level])
+	}
+
+	return line.String(), nil
+}
+
+// downsample is a private helper function that splits values into the given number of
+// evenly sized buckets and returns the average of each bucket.
+func downsample(values []float64, buckets int) []float64 {
+	averages := make([]float64, buckets)
+
+	for i := range averages {
+		start := i * len(values) / buckets
+		end := (i + 1) * len(values) / buckets
+
+		var sum float64
+		for _, value := range values[start:end] {
+			sum += value
+		}
+
+		averages[i] = sum / float64(end-start)
+	}
+
+	return averages
+}
+
+// GustPercentiles is a public method that returns the requested percentiles of
+// Windgustmph over every record in d, keyed by percentile. Percentiles are given as a
+// fraction between 0 and 1 (i.e. 0.95 for the 95th percentile) and are computed with
+// linear interpolation between the closest ranks. This is useful to assess how exposed
+// a site is and how often extreme gusts occur.
+//
+// Basic Usage:
+//
+//	gusts, err := data.GustPercentiles(0.5, 0.95, 0.99)
+//	fmt.Println(gusts[0.95])
+func (d DeviceDataResponse) GustPercentiles(ps ...float64) (map[float64]float64, error) {
+	for _, p := range ps {
+		if p < 0 || p > 1 || math.IsNaN(p) {
+			return nil, fmt.Errorf("percentile must be between 0 and 1, got %v", p)
+		}
+	}
+
+	if len(d) == 0 {
+		return nil, errors.New("no records to compute gust percentiles from")
+	}
+
+	gusts, err := d.fieldValues("windgustmph")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Float64s(gusts)
+
+	percentiles := make(map[float64]float64, len(ps))
+	for _, p := range ps {
+		percentiles[p] = percentile(gusts, p)
+	}
+
+	return percentiles, nil
+}
+
+// percentile is a private helper function that returns the p percentile (between 0 and
+// 1) of a sorted, non-empty slice, interpolating linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// DailyUVDose is a public method that returns the cumulative UV exposure for every day
+// in d, in UV-index-hours, keyed by the UTC day. The UV index is integrated over time
+// with the trapezoidal rule, so irregular sampling intervals are weighted correctly. Only
+// consecutive records on the same day are integrated, so a day with a single record has
+// a dose of 0.
+//
+// Basic Usage:
+//
+//	doses := data.DailyUVDose()
+//	fmt.Println(doses["2023-07-01"])
+func (d DeviceDataResponse) DailyUVDose() map[YearMonthDay]float64 {
+	doses := make(map[YearMonthDay]float64)
+
+	records := d.chronological()
+	for i, record := range records {
+		day := YearMonthDay(time.UnixMilli(record.Dateutc).UTC().Format(time.DateOnly))
+		if _, ok := doses[day]; !ok {
+			doses[day] = 0
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		previous := records[i-1]
+		if YearMonthDay(time.UnixMilli(previous.Dateutc).UTC().Format(time.DateOnly)) != day {
+			continue
+		}
+
+		hours := time.Duration(record.Dateutc-previous.Dateutc) * time.Millisecond
+		doses[day] += float64(previous.Uv+record.Uv) / 2 * hours.Hours()
+	}
+
+	return doses
+}
+
+// batteryLow is a private helper function that reports, for each battery-backed sensor
+// of a record, whether its battery is low. Sensors that did not report are left out.
+// Note that the lightning detector uses 1 for a low battery, unlike the other sensors.
+func (w WeatherRecord) batteryLow() map[string]bool {
+	low := map[string]bool{"batt_lightning": w.BattLightning == 1}
+
+	if w.Batt1 != nil {
+		low["batt1"] = *w.Batt1 == 0
+	}
+
+	if w.Battin != nil {
+		low["battin"] = *w.Battin == 0
+	}
+
+	if w.Battout != nil {
+		low["battout"] = *w.Battout == 0
+	}
+
+	return low
+}
+
+// BatteryTimeline is a public method that returns a BatteryEvent every time that the
+// battery of a sensor goes from OK to low, or from low back to OK, from the oldest record
+// to the newest. Every sensor is assumed to start out OK, so a sensor that is already
+// low in the first record gets an event at that record. Records where a sensor did not
+// report leave its state unchanged. This helps to know when batteries need to be
+// replaced, and when they were.
+//
+// Basic Usage:
+//
+//	for _, event := range data.BatteryTimeline() {
+//		fmt.Printf("%v low=%v at %v\n", event.Sensor, event.Low, event.Date)
+//	}
+func (d DeviceDataResponse) BatteryTimeline() []BatteryEvent {
+	var events []BatteryEvent
+
+	state := make(map[string]bool)
+
+	for _, record := range d.chronological() {
+		low := record.batteryLow()
+
+		sensors := make([]string, 0, len(low))
+		for sensor := range low {
+			sensors = append(sensors, sensor)
+		}
+		sort.Strings(sensors)
+
+		for _, sensor := range sensors {
+			if state[sensor] == low[sensor] {
+				continue
+			}
+
+			state[sensor] = low[sensor]
+			events = append(events, BatteryEvent{
+				Date:   time.UnixMilli(record.Dateutc).UTC(),
+				Low:    low[sensor],
+				Sensor: sensor,
+			})
+		}
+	}
+
+	return events
+}
+
+// FilterByDateRange is a public function that returns the records whose Date falls
+// between start and end, inclusive, in their original order. Records without a Date,
+// which happens when it could not be parsed, are left out. This is useful to slice a
+// smaller window out of a large historical pull without another call to the API.
+//
+// Basic Usage:
+//
+//	morning := awn.FilterByDateRange(records, sunrise, noon)
+func FilterByDateRange(records []WeatherRecord, start time.Time, end time.Time) []WeatherRecord {
+	filtered := make([]WeatherRecord, 0)
+
+	for _, record := range records {
+		if record.Date.IsZero() || record.Date.Before(start) || record.Date.After(end) {
+			continue
+		}
+
+		filtered = append(filtered, record)
+	}
+
+	return filtered
+}
+
+// RainfallTotal is a public function that returns the rainfall, in inches, over the
+// period covered by records. It is computed from Dailyrainin, which is an accumulator
+// that resets to 0 at midnight, so summing the values would count the same rain many
+// times. Instead, the records are put in chronological order and the increase between
+// each pair of consecutive records is added up. When the value goes down, the
+// accumulator is assumed to have reset in between, and the new value is the rain that
+// has fallen since the reset. Rain that fell before the oldest record is not counted.
+//
+// Basic Usage:
+//
+//	inches := awn.RainfallTotal(records)
+func RainfallTotal(records []WeatherRecord) float64 {
+	var total float64
+
+	sorted := DeviceDataResponse(records).chronological()
+	for i := 1; i < len(sorted); i++ {
+		previous, current := sorted[i-1].Dailyrainin, sorted[i].Dailyrainin
+		if current < previous {
+			total += current
+			continue
+		}
+
+		total += current - previous
+	}
+
+	return total
+}
+
+// PressureTrend is a public function that reports whether the relative pressure
+// (Baromrelin) is rising, falling or steady over the trailing window, which is usually 3
+// hours, along with the change in inches of mercury. It uses a threshold of 0.02 inHg,
+// see PressureTrendWithThreshold.
+//
+// Basic Usage:
+//
+//	trend, delta := awn.PressureTrend(records, 3*time.Hour)
+func PressureTrend(records []WeatherRecord, window time.Duration) (string, float64) {
+	return PressureTrendWithThreshold(records, window, pressureTrendThresholdInHg)
+}
+
+// PressureTrendWithThreshold is a public function that works like PressureTrend, but
+// with a custom threshold, in inches of mercury. The window ends at the newest record,
+// and the change is measured from the oldest record in the window to the newest one. It
+// is PressureRising if the change is threshold or more, PressureFalling if it is
+// -threshold or less, and PressureSteady otherwise. With fewer than two records in the
+// window, there is nothing to compare, so it returns PressureSteady and a change of 0.
+//
+// Basic Usage:
+//
+//	trend, delta := awn.PressureTrendWithThreshold(records, 3*time.Hour, 0.06)
+func PressureTrendWithThreshold(records []WeatherRecord, window time.Duration, threshold float64) (string, float64) {
+	sorted := DeviceDataResponse(records).chronological()
+	if len(sorted) < 2 { //nolint:gomnd
+		return PressureSteady, 0
+	}
+
+	newest := sorted[len(sorted)-1]
+	start := newest.Dateutc - window.Milliseconds()
+
+	oldest := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i].Dateutc >= start
+	})
+	if oldest >= len(sorted)-1 {
+		return PressureSteady, 0
+	}
+
+	delta := newest.Baromrelin - sorted[oldest].Baromrelin
+
+	switch {
+	case delta >= threshold:
+		return PressureRising, delta
+	case delta <= -threshold:
+		return PressureFalling, delta
+	default:
+		return PressureSteady, delta
+	}
+}
@@ -0,0 +1,432 @@
+package awn
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFrostEvents(t *testing.T) {
+	t.Parallel()
+	night := time.Date(2023, 10, 20, 4, 0, 0, 0, time.UTC)
+
+	calm := DeviceDataResponse{
+		{Date: night, Tempf: 40.1, Windspeedmph: 1.1, Humidity: 85},
+		{Date: night.Add(time.Hour), Tempf: 35.6, Windspeedmph: 0.0, Humidity: 92},
+		{Date: night.Add(2 * time.Hour), Tempf: 33.8, Windspeedmph: 2.2, Humidity: 95},
+	}
+	windy := DeviceDataResponse{
+		{Date: night, Tempf: 35.2, Windspeedmph: 12.5, Humidity: 88},
+		{Date: night.Add(time.Hour), Tempf: 33.1, Windspeedmph: 15.0, Humidity: 90},
+	}
+
+	tests := []struct {
+		name string
+		d    DeviceDataResponse
+		want []FrostEvent
+	}{
+		{name: "ColdCalmHumid", d: calm, want: []FrostEvent{
+			{Date: night.Add(time.Hour), Tempf: 35.6, Windspeedmph: 0.0, Humidity: 92},
+			{Date: night.Add(2 * time.Hour), Tempf: 33.8, Windspeedmph: 2.2, Humidity: 95},
+		}},
+		{name: "ColdButWindy", d: windy, want: nil},
+		{name: "Empty", d: DeviceDataResponse{}, want: nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.d.FrostEvents(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FrostEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrostEventsWithThresholds(t *testing.T) {
+	t.Parallel()
+	night := time.Date(2023, 10, 20, 4, 0, 0, 0, time.UTC)
+
+	d := DeviceDataResponse{
+		{Date: night, Tempf: 35.2, Windspeedmph: 12.5, Humidity: 88},
+		{Date: night.Add(time.Hour), Tempf: 38.0, Windspeedmph: 1.0, Humidity: 90},
+	}
+
+	thresholds := DefaultFrostThresholds()
+	thresholds.MaxWindspeedmph = 15
+
+	want := []FrostEvent{{Date: night, Tempf: 35.2, Windspeedmph: 12.5, Humidity: 88}}
+	if got := d.FrostEventsWithThresholds(thresholds); !reflect.DeepEqual(got, want) {
+		t.Errorf("FrostEventsWithThresholds() = %v, want %v", got, want)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	t.Parallel()
+	// newest-first, like the API returns it
+	d := DeviceDataResponse{
+		{Dateutc: 8, Tempf: 70}, {Dateutc: 7, Tempf: 68}, {Dateutc: 6, Tempf: 64}, {Dateutc: 5, Tempf: 62},
+		{Dateutc: 4, Tempf: 60}, {Dateutc: 3, Tempf: 58}, {Dateutc: 2, Tempf: 54}, {Dateutc: 1, Tempf: 50},
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		width int
+		want  string
+	}{
+		{"TestOneCharPerRecord", "tempf", 8, "▁▂▃▄▅▅▇█"},
+		{"TestWiderThanData", "tempf", 20, "▁▂▃▄▅▅▇█"},
+		{"TestDownsampled", "tempf", 4, "▁▃▅█"},
+		{"TestSingleChar", "tempf", 1, "▁"},
+		{"TestFlatLine", "humidity", 8, "▁▁▁▁▁▁▁▁"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := d.Sparkline(tt.field, tt.width)
+			if err != nil {
+				t.Fatalf("Sparkline() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Sparkline() = %v, want %v", got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n != min(tt.width, len(d)) {
+				t.Errorf("Sparkline() length = %v, want %v", n, min(tt.width, len(d)))
+			}
+		})
+	}
+}
+
+func TestSparklineMinMax(t *testing.T) {
+	t.Parallel()
+	d := DeviceDataResponse{{Dateutc: 1, Windgustmph: 3.1}, {Dateutc: 2, Windgustmph: 27.4}, {Dateutc: 3, Windgustmph: 9.8}}
+
+	got, err := d.Sparkline("windgustmph", 3)
+	if err != nil {
+		t.Fatalf("Sparkline() error = %v", err)
+	}
+
+	runes := []rune(got)
+	if runes[0] != '▁' || runes[1] != '█' {
+		t.Errorf("Sparkline() = %v, want the minimum drawn as ▁ and the maximum as █", got)
+	}
+}
+
+func TestSparklineErrors(t *testing.T) {
+	t.Parallel()
+	d := DeviceDataResponse{{Dateutc: 1, Tempf: 70}}
+
+	tests := []struct {
+		name    string
+		d       DeviceDataResponse
+		field   string
+		width   int
+		wantErr error
+		wantMsg string
+	}{
+		{"TestUnknownField", d, "notAField", 10, ErrUnknownField,
+			`unknown or unsupported weather record field: "notAField"`},
+		{"TestNonNumericField", d, "tz", 10, ErrUnknownField,
+			`unknown or unsupported weather record field: "tz" is not numeric`},
+		{"TestZeroWidth", d, "tempf", 0, nil, ""},
+		{"TestEmpty", DeviceDataResponse{}, "tempf", 10, nil, ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := tt.d.Sparkline(tt.field, tt.width)
+			if err == nil {
+				t.Fatalf("Sparkline() error = %v, want an error", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Sparkline() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && err.Error() != tt.wantMsg {
+				t.Errorf("Sparkline() error = %q, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestGustPercentiles(t *testing.T) {
+	t.Parallel()
+	// gusts of 1 through 101 mph, in no particular order
+	d := make(DeviceDataResponse, 0, 101)
+	for i := 101; i >= 1; i -= 2 {
+		d = append(d, WeatherRecord{Windgustmph: float64(i)})
+	}
+	for i := 2; i <= 100; i += 2 {
+		d = append(d, WeatherRecord{Windgustmph: float64(i)})
+	}
+
+	got, err := d.GustPercentiles(0, 0.5, 0.95, 0.99, 1)
+	if err != nil {
+		t.Fatalf("GustPercentiles() error = %v", err)
+	}
+
+	want := map[float64]float64{0: 1, 0.5: 51, 0.95: 96, 0.99: 100, 1: 101}
+	for p, w := range want {
+		if math.Abs(got[p]-w) > 1e-9 {
+			t.Errorf("GustPercentiles()[%v] = %v, want %v", p, got[p], w)
+		}
+	}
+}
+
+func TestGustPercentilesInterpolation(t *testing.T) {
+	t.Parallel()
+	d := DeviceDataResponse{{Windgustmph: 10}, {Windgustmph: 20}}
+
+	got, err := d.GustPercentiles(0.25)
+	if err != nil {
+		t.Fatalf("GustPercentiles() error = %v", err)
+	}
+	if got[0.25] != 12.5 {
+		t.Errorf("GustPercentiles()[0.25] = %v, want 12.5", got[0.25])
+	}
+}
+
+func TestGustPercentilesErrors(t *testing.T) {
+	t.Parallel()
+	d := DeviceDataResponse{{Windgustmph: 10}}
+
+	tests := []struct {
+		name string
+		d    DeviceDataResponse
+		ps   []float64
+	}{
+		{"TestBelowZero", d, []float64{-0.1}},
+		{"TestAboveOne", d, []float64{0.5, 1.5}},
+		{"TestNaN", d, []float64{math.NaN()}},
+		{"TestEmpty", DeviceDataResponse{}, []float64{0.5}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := tt.d.GustPercentiles(tt.ps...); err == nil {
+				t.Errorf("GustPercentiles() error = %v, want an error", err)
+			}
+		})
+	}
+}
+
+func TestDailyUVDose(t *testing.T) {
+	t.Parallel()
+	sunrise := time.Date(2023, 7, 1, 6, 0, 0, 0, time.UTC)
+
+	// a UV index that climbs from 0 at 06:00 to 6 at noon and falls back to 0 at 18:00
+	var day DeviceDataResponse
+	for h := 0; h <= 12; h++ {
+		uv := 6 - int(math.Abs(float64(h-6)))
+		day = append(day, WeatherRecord{Dateutc: sunrise.Add(time.Duration(h) * time.Hour).UnixMilli(), Uv: uv})
+	}
+
+	// samples at 10:00, 11:00 and 13:00 with a UV index of 2, 4 and 4: 3 + 8
+	irregular := DeviceDataResponse{
+		{Dateutc: time.Date(2023, 7, 2, 13, 0, 0, 0, time.UTC).UnixMilli(), Uv: 4},
+		{Dateutc: time.Date(2023, 7, 2, 11, 0, 0, 0, time.UTC).UnixMilli(), Uv: 4},
+		{Dateutc: time.Date(2023, 7, 2, 10, 0, 0, 0, time.UTC).UnixMilli(), Uv: 2},
+	}
+
+	tests := []struct {
+		name string
+		d    DeviceDataResponse
+		want map[YearMonthDay]float64
+	}{
+		{"TestDaytimeCurve", day, map[YearMonthDay]float64{"2023-07-01": 36}},
+		{"TestIrregularSampling", irregular, map[YearMonthDay]float64{"2023-07-02": 11}},
+		{"TestMultipleDays", append(append(DeviceDataResponse{}, day...), irregular...),
+			map[YearMonthDay]float64{"2023-07-01": 36, "2023-07-02": 11}},
+		{"TestSingleRecord", day[:1], map[YearMonthDay]float64{"2023-07-01": 0}},
+		{"TestEmpty", DeviceDataResponse{}, map[YearMonthDay]float64{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.d.DailyUVDose(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DailyUVDose() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatteryTimeline(t *testing.T) {
+	t.Parallel()
+	ok, low := 1, 0
+	at := func(h int) int64 { return time.Date(2023, 11, 1, h, 0, 0, 0, time.UTC).UnixMilli() }
+	date := func(h int) time.Time { return time.Date(2023, 11, 1, h, 0, 0, 0, time.UTC) }
+
+	// the outdoor sensor drops out mid-way and is back after its batteries are replaced
+	dropout := DeviceDataResponse{
+		{Dateutc: at(5), Battout: &ok, Battin: &ok},
+		{Dateutc: at(4), Battout: &ok},
+		{Dateutc: at(3), Battout: &low, Battin: &ok},
+		{Dateutc: at(2), Battout: &low, Battin: &ok},
+		{Dateutc: at(1), Battout: &ok, Battin: &ok},
+	}
+	lightning := DeviceDataResponse{
+		{Dateutc: at(1), BattLightning: 1},
+		{Dateutc: at(2), BattLightning: 1},
+		{Dateutc: at(3), BattLightning: 0},
+	}
+
+	tests := []struct {
+		name string
+		d    DeviceDataResponse
+		want []BatteryEvent
+	}{
+		{"TestDropout", dropout, []BatteryEvent{
+			{Date: date(2), Low: true, Sensor: "battout"},
+			{Date: date(4), Low: false, Sensor: "battout"},
+		}},
+		{"TestLowFromTheStart", lightning, []BatteryEvent{
+			{Date: date(1), Low: true, Sensor: "batt_lightning"},
+			{Date: date(3), Low: false, Sensor: "batt_lightning"},
+		}},
+		{"TestNoSensors", DeviceDataResponse{{Dateutc: at(1)}, {Dateutc: at(2)}}, nil},
+		{"TestEmpty", DeviceDataResponse{}, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.d.BatteryTimeline(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BatteryTimeline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterByDateRange(t *testing.T) {
+	t.Parallel()
+	date := func(m int) time.Time { return time.Date(2023, 11, 1, 12, m, 0, 0, time.UTC) }
+	records := []WeatherRecord{
+		{Date: date(0), Tempf: 60},
+		{Date: date(5), Tempf: 61},
+		{Tempf: 62}, // the date failed to parse
+		{Date: date(10), Tempf: 63},
+		{Date: date(15), Tempf: 64},
+	}
+
+	tests := []struct {
+		name      string
+		start     time.Time
+		end       time.Time
+		wantTemps []float64
+	}{
+		{"TestBoundariesAreInclusive", date(5), date(10), []float64{61, 63}},
+		{"TestBetweenRecords", date(6), date(14), []float64{63}},
+		{"TestEverything", date(-1), date(20), []float64{60, 61, 63, 64}},
+		{"TestZeroStart", time.Time{}, date(0), []float64{60}},
+		{"TestNothing", date(16), date(20), []float64{}},
+		{"TestStartAfterEnd", date(10), date(5), []float64{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := FilterByDateRange(records, tt.start, tt.end)
+
+			temps := make([]float64, 0, len(got))
+			for _, record := range got {
+				temps = append(temps, record.Tempf)
+			}
+			if !reflect.DeepEqual(temps, tt.wantTemps) {
+				t.Errorf("FilterByDateRange() temperatures = %v, want %v", temps, tt.wantTemps)
+			}
+		})
+	}
+}
+
+func TestRainfallTotal(t *testing.T) {
+	t.Parallel()
+	// rain is given oldest first and sampled every hour, but returned newest first as the
+	// API does
+	series := func(rain ...float64) []WeatherRecord {
+		records := make([]WeatherRecord, len(rain))
+		for i, inches := range rain {
+			records[len(rain)-1-i] = WeatherRecord{Dateutc: int64(i) * time.Hour.Milliseconds(), Dailyrainin: inches}
+		}
+		return records
+	}
+
+	tests := []struct {
+		name    string
+		records []WeatherRecord
+		want    float64
+	}{
+		{"TestRising", series(0, 0.25, 0.5, 1.25), 1.25},
+		{"TestStartsPartway", series(0.5, 0.75, 1), 0.5},
+		{"TestRisingThenReset", series(0.25, 0.5, 1, 0, 0.25, 0.5), 1.25},
+		{"TestResetWithRainSince", series(0.5, 1, 0.25, 0.5), 1},
+		{"TestMultipleResets", series(0.5, 0, 0.5, 0.25, 0.75), 1.25},
+		{"TestDry", series(0, 0, 0), 0},
+		{"TestSingleRecord", series(1.5), 0},
+		{"TestEmpty", nil, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := RainfallTotal(tt.records); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("RainfallTotal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPressureTrend(t *testing.T) {
+	t.Parallel()
+	// pressure is given oldest first and sampled every 30 minutes
+	series := func(inHg ...float64) []WeatherRecord {
+		records := make([]WeatherRecord, len(inHg))
+		for i, pressure := range inHg {
+			records[i] = WeatherRecord{Dateutc: int64(i) * (30 * time.Minute).Milliseconds(), Baromrelin: pressure}
+		}
+		return records
+	}
+
+	tests := []struct {
+		name      string
+		records   []WeatherRecord
+		window    time.Duration
+		wantTrend string
+		wantDelta float64
+	}{
+		{"TestRising", series(29.80, 29.82, 29.85, 29.87, 29.90, 29.92, 29.95), 3 * time.Hour, PressureRising, 0.15},
+		{"TestFalling", series(30.10, 30.08, 30.05, 30.01, 29.98, 29.94, 29.90), 3 * time.Hour, PressureFalling, -0.20},
+		{"TestSteady", series(30.00, 30.01, 30.00, 29.99, 30.00, 30.01, 30.01), 3 * time.Hour, PressureSteady, 0.01},
+		{"TestOnlyTheWindow", series(29.50, 30.00, 30.00, 30.01), time.Hour, PressureSteady, 0.01},
+		{"TestFallingInTheWindow", series(29.50, 30.00, 29.95, 29.90), time.Hour, PressureFalling, -0.10},
+		{"TestOneRecordInTheWindow", series(29.50, 30.00), 10 * time.Minute, PressureSteady, 0},
+		{"TestSingleRecord", series(30.00), 3 * time.Hour, PressureSteady, 0},
+		{"TestEmpty", nil, 3 * time.Hour, PressureSteady, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			trend, delta := PressureTrend(tt.records, tt.window)
+			if trend != tt.wantTrend || math.Abs(delta-tt.wantDelta) > 1e-9 {
+				t.Errorf("PressureTrend() = %v, %v, want %v, %v", trend, delta, tt.wantTrend, tt.wantDelta)
+			}
+		})
+	}
+
+	// newest first, as returned by the API
+	records := series(29.80, 29.90)
+	records[0], records[1] = records[1], records[0]
+	if trend, _ := PressureTrendWithThreshold(records, time.Hour, 0.2); trend != PressureSteady {
+		t.Errorf("PressureTrendWithThreshold() = %v, want %v under a higher threshold", trend, PressureSteady)
+	}
+	if trend, _ := PressureTrendWithThreshold(records, time.Hour, 0.05); trend != PressureRising {
+		t.Errorf("PressureTrendWithThreshold() = %v, want %v", trend, PressureRising)
+	}
+}
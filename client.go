@@ -7,22 +7,42 @@
 package awn
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
 )
 
+// APIVersion is the version route of the Ambient Weather Network API that this client
+// targets. Pass it as the version of functions such as CreateAwnClient and
+// GetHistoricalData.
+const APIVersion = "/v1"
+
+// SupportedAPIVersions is a public function that returns every version route of the
+// Ambient Weather Network API that this client can talk to, starting with APIVersion.
+//
+// Basic Usage:
+//
+//	versions := awn.SupportedAPIVersions()
+func SupportedAPIVersions() []string {
+	return []string{APIVersion}
+}
+
 const (
-	// debugMode Enable verbose logging by setting this boolean value to true.
+	// debugMode Enable verbose logging by setting this boolean value to true. Every client
+	// dumps its requests and, unless SetLogger was called, every message down to the debug
+	// level is written to stderr.
 	debugMode = false
 
 	// defaultCtxTimeout Set the context timeout, in seconds, as an int.
@@ -31,9 +51,29 @@ const (
 	// devicesEndpoint The 'devices' endpoint as a string.
 	devicesEndpoint = "devices"
 
+	// defaultRequestsPerSecond is the number of API calls per second that a client will
+	// make by default. The Ambient Weather API allows one call per second per API key.
+	defaultRequestsPerSecond rate.Limit = 1
+
+	// modulePath is the import path of this module, which is used to find its version in
+	// the build info.
+	modulePath = "github.com/d-dot-one/awn"
+
+	// userAgentName is the product name sent in the default User-Agent header.
+	userAgentName = "ambient-weather-client"
+
+	// maxLimit is the maximum number of records that the devices/macAddress endpoint
+	// returns in a single call.
+	maxLimit = 288
+
 	// epochIncrement24h is the number of milliseconds in a 24-hour period.
 	epochIncrement24h int64 = 86400000
 
+	// recordIntervalMillis is the number of milliseconds between two records of a weather
+	// station that uploads as often as the API allows, which is every 5 minutes, or
+	// maxLimit times a day.
+	recordIntervalMillis = epochIncrement24h / maxLimit
+
 	// retryCount An integer describing the number of times to retry in case of
 	// failure or rate limiting.
 	retryCount = 3
@@ -59,15 +99,27 @@ type (
 )
 
 // verify is a private helper function that will check that the date string passed from
-// the caller is in the correct format. It will return a boolean value and an error.
+// the caller is in the correct format. The whole string must be a YYYY-MM-DD date, with a
+// month from 01 to 12 and a day from 01 to 31. It will return a boolean value and an
+// error.
 func (y YearMonthDay) verify() (bool, error) {
-	match, err := regexp.MatchString(`\d{4}-\d{2}-\d{2}`, y.String())
+	pattern, err := regexp.Compile(`^\d{4}-(\d{2})-(\d{2})$`)
 	if err != nil {
 		return false, ErrRegexFailed
 	}
-	if !match {
+
+	match := pattern.FindStringSubmatch(y.String())
+	if match == nil {
+		return false, ErrMalformedDate
+	}
+
+	month, _ := strconv.Atoi(match[1])
+	day, _ := strconv.Atoi(match[2])
+
+	if month < 1 || month > 12 || day < 1 || day > 31 {
 		return false, ErrMalformedDate
 	}
+
 	return true, nil
 }
 
@@ -88,18 +140,19 @@ func (y YearMonthDay) String() string {
 func ConvertTimeToEpoch(tte string) (int64, error) {
 	ok, err := YearMonthDay(tte).verify() //nolint:varnamelen
 	if err != nil {
-		log.Printf("unable to verify date")
+		getLogger().Error("unable to verify date", "date", tte, "error", err)
 		err = fmt.Errorf("unable to verify date: %w", err)
 		return 0, err
 	}
 
 	if !ok {
-		log.Fatalf("invalid date format, %v should be YYYY-MM-DD", tte)
+		getLogger().Error("invalid date format, should be YYYY-MM-DD", "date", tte)
+		return 0, ErrMalformedDate
 	}
 
 	parsed, err := time.Parse(time.DateOnly, tte)
 	if err != nil {
-		log.Printf("unable to parse time")
+		getLogger().Error("unable to parse time", "date", tte, "error", err)
 		err = fmt.Errorf("unable to parse time: %w", err)
 		return 0, err
 	}
@@ -107,72 +160,356 @@ func ConvertTimeToEpoch(tte string) (int64, error) {
 	return parsed.UnixMilli(), nil
 }
 
+// BatchConvertTimeToEpoch is a public helper function that works like
+// ConvertTimeToEpoch, but converts every date in dates, in order. If a date is malformed,
+// it stops and returns ErrMalformedDate, which carries the index of the date and wraps
+// the underlying error.
+//
+// Basic Usage:
+//
+//	epochs, err := awn.BatchConvertTimeToEpoch([]string{"2023-01-01", "2023-01-02"})
+func BatchConvertTimeToEpoch(dates []string) ([]int64, error) {
+	epochs := make([]int64, len(dates))
+
+	for i, date := range dates {
+		epoch, err := ConvertTimeToEpoch(date)
+		if err != nil {
+			return nil, ErrMalformedDate.from(i, err)
+		}
+
+		epochs[i] = epoch
+	}
+
+	return epochs, nil
+}
+
+// NormalizeMacAddress is a public function that takes the MAC address of a weather
+// station as 00:11:22:33:44:55, 00-11-22-33-44-55 or 001122334455, in upper or lower case,
+// and returns it in the form used by the API, which is lower case and colon-delimited. It
+// returns ErrMalformedMacAddress, with the number of characters, for anything else.
+//
+// Basic Usage:
+//
+//	mac, err := awn.NormalizeMacAddress("00-11-22-AA-BB-CC")
+func NormalizeMacAddress(mac string) (string, error) {
+	pattern, err := regexp.Compile(`^(?:[0-9a-f]{2}(?::[0-9a-f]{2}){5}|[0-9a-f]{2}(?:-[0-9a-f]{2}){5}|[0-9a-f]{12})$`)
+	if err != nil {
+		return "", ErrRegexFailed
+	}
+
+	mac = strings.ToLower(mac)
+	if !pattern.MatchString(mac) {
+		return "", ErrMalformedMacAddress.withDetail("length %v", len(mac))
+	}
+
+	digits := strings.NewReplacer(":", "", "-", "").Replace(mac)
+	octets := make([]string, 0, len(digits)/2)
+
+	for i := 0; i < len(digits); i += 2 {
+		octets = append(octets, digits[i:i+2])
+	}
+
+	return strings.Join(octets, ":"), nil
+}
+
 // CreateAwnClient is a public function that is used to create a new resty-based API
 // client. It takes the URL that you would like to connect to and the API version as inputs
 // from the caller. This client supports retries and can be placed into debug mode when
 // needed. By default, it will also set the accept content type to JSON. Finally, it
-// returns a pointer to the client and an error.
+// returns a pointer to the client and an error. It is a wrapper around
+// CreateAwnClientWithOptions that uses the default ClientOptions.
+//
+// It returns ErrInvalidClientConfig if url is empty, cannot be parsed or has no scheme or
+// host (i.e. "https://rt.ambientweather.net"), or if version is empty.
 //
 // Basic Usage:
 //
 //	client, err := createAwnClient()
 func CreateAwnClient(url string, version string) (*resty.Client, error) {
+	return CreateAwnClientWithOptions(url, version, ClientOptions{}) //nolint:exhaustruct
+}
+
+// CreateAwnClientWithContext is a public function that works like CreateAwnClient, but
+// checks that the API can be reached before returning the client. It sends a HEAD
+// request to the base URL and returns an error if the host cannot be resolved, the
+// connection is refused or ctx ends first. Any HTTP response, whatever its status,
+// counts as reachable. The check does not go through the rate limiter or the retries.
+// CreateAwnClient stays lazy and never connects until the first call.
+//
+// Basic Usage:
+//
+//	client, err := awn.CreateAwnClientWithContext(ctx, "https://rt.ambientweather.net", awn.APIVersion)
+func CreateAwnClientWithContext(ctx context.Context, url string, version string) (*resty.Client, error) {
+	client, err := CreateAwnClient(url, version)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, client.BaseURL, nil)
+	if err != nil {
+		getLogger().Error("unable to create health check request", "url", client.BaseURL, "error", err)
+		return nil, fmt.Errorf("unable to create health check request: %w", err)
+	}
+
+	resp, err := client.GetClient().Do(req)
+	if err != nil {
+		getLogger().Error("unable to reach the api", "url", client.BaseURL, "error", err)
+		return nil, fmt.Errorf("unable to reach %v: %w", client.BaseURL, err)
+	}
+	_ = resp.Body.Close()
+
+	return client, nil
+}
+
+// CreateAwnClientWithOptions is a public function that works like CreateAwnClient, but
+// allows the caller to tune the retry and timeout behavior of the client with a
+// ClientOptions struct. Any zero-value fields in the struct fall back to the package
+// defaults.
+//
+// Every client asks for gzip-compressed responses, which greatly reduces the size of
+// large historical pulls. The responses are decompressed before they are decoded.
+//
+// Only GET requests are retried, on a 408, a 429 or a 5xx response, or when no response
+// is received at all, such as on a refused connection. Every call to the API is a GET
+// today, but requests with any other verb, such as a POST, are sent exactly once, since
+// they may not be safe to repeat.
+//
+// Basic Usage:
+//
+//	client, err := awn.CreateAwnClientWithOptions(url, version, awn.ClientOptions{
+//		RetryCount: 1,
+//		Timeout:    5 * time.Second,
+//	})
+func CreateAwnClientWithOptions(url string, version string, opts ClientOptions) (*resty.Client, error) {
+	err := checkClientConfig(url, version)
+	if err != nil {
+		getLogger().Error("invalid client config", "url", url, "version", version, "error", err)
+		return nil, err
+	}
+
+	opts = opts.withDefaults()
+
+	err = checkProxy(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
 	client := resty.New().
-		SetRetryCount(retryCount).
-		SetRetryWaitTime(retryMinWaitTimeSeconds*time.Second).
-		SetRetryMaxWaitTime(retryMaxWaitTimeSeconds*time.Second).
+		SetRetryCount(opts.RetryCount).
+		SetRetryWaitTime(opts.RetryMinWaitTime).
+		SetRetryMaxWaitTime(opts.RetryMaxWaitTime).
 		SetBaseURL(url+version).
 		SetHeader("Accept", "application/json").
-		SetTimeout(defaultCtxTimeout * time.Second).
-		SetDebug(debugMode).
-		AddRetryCondition(
-			func(r *resty.Response, e error) bool {
-				return r.StatusCode() == http.StatusRequestTimeout ||
-					r.StatusCode() >= http.StatusInternalServerError ||
-					r.StatusCode() == http.StatusTooManyRequests
-			})
+		SetHeader("Accept-Encoding", "gzip").
+		SetHeader("User-Agent", opts.UserAgent).
+		SetTimeout(opts.Timeout).
+		SetDebug(opts.Debug).
+		SetLogger(restyLogger{}).
+		OnBeforeRequest(stampEndpoint).
+		OnBeforeRequest(
+			func(_ *resty.Client, r *resty.Request) error {
+				return opts.RateLimiter.Wait(r.Context()) //nolint:wrapcheck
+			}).
+		OnAfterResponse(observeResponse(opts.Metrics)).
+		OnError(observeError(opts.Metrics)).
+		AddRetryHook(observeRetry(opts.Metrics))
+
+	// a custom transport brings its own proxy settings, if any, and without an explicit
+	// proxy the default transport already honors the proxy environment variables
+	if opts.Transport != nil {
+		client.SetTransport(opts.Transport)
+	} else if opts.Proxy != "" {
+		client.SetProxy(opts.Proxy)
+	}
+
+	// callers with their own retry logic get exactly one attempt
+	if opts.DisableRetries {
+		return client, nil
+	}
+
+	client.AddRetryCondition(
+		func(r *resty.Response, e error) bool {
+			// there is no response when a request fails before it is sent, such as
+			// when the rate limiter gives up waiting
+			if r == nil {
+				return false
+			}
+
+			// only GETs are safe to send twice, so any other verb that is added later
+			// is not retried by accident
+			if r.Request.Method != http.MethodGet {
+				return false
+			}
+
+			// a call that got no response at all, such as a refused connection, is
+			// retried just like a server error
+			if e != nil && r.RawResponse == nil {
+				return true
+			}
+
+			return r.StatusCode() == http.StatusRequestTimeout ||
+				r.StatusCode() >= http.StatusInternalServerError ||
+				r.StatusCode() == http.StatusTooManyRequests
+		})
+
+	var retryAfter resty.RetryAfterFunc
+
+	if opts.Jitter {
+		retryAfter = fullJitterBackoff(opts.RetryMinWaitTime, opts.RetryMaxWaitTime)
+	}
+
+	if opts.MaxRetryElapsedTime > 0 {
+		client.OnBeforeRequest(stampRetryStart)
+		retryAfter = retryBudget(opts.MaxRetryElapsedTime, opts.RetryMinWaitTime, opts.RetryMaxWaitTime, retryAfter)
+	}
+
+	if retryAfter != nil {
+		client.SetRetryAfter(retryAfter)
+	}
 
 	return client, nil
 }
 
+// Client is a wrapper around the resty-based API client created by CreateAwnClient. It
+// embeds the resty client, so it can be used anywhere that one is needed, but it also
+// remembers the API version and the rate limiter that it was created with.
+type Client struct {
+	*resty.Client
+	limiter *rate.Limiter
+	version string
+}
+
+// ClientConfig is a comparable struct that describes the effective configuration of a
+// Client. BaseURL is the URL that requests are sent to, including the version route.
+type ClientConfig struct {
+	BaseURL          string        `json:"baseUrl"`
+	Version          string        `json:"version"`
+	RetryCount       int           `json:"retryCount"`
+	RetryMinWaitTime time.Duration `json:"retryMinWaitTime"`
+	RetryMaxWaitTime time.Duration `json:"retryMaxWaitTime"`
+	Timeout          time.Duration `json:"timeout"`
+	Debug            bool          `json:"debug"`
+	RateLimit        rate.Limit    `json:"rateLimit"`
+}
+
+// NewClient is a public function that creates a new Client. It takes the same URL and
+// API version as CreateAwnClient and returns a pointer to the Client and an error.
+//
+// Basic Usage:
+//
+//	client, err := awn.NewClient("https://rt.ambientweather.net", awn.APIVersion)
+func NewClient(url string, version string) (*Client, error) {
+	return NewClientWithOptions(url, version, ClientOptions{}) //nolint:exhaustruct
+}
+
+// NewClientWithOptions is a public function that works like NewClient, but takes a
+// ClientOptions struct that is passed to CreateAwnClientWithOptions.
+//
+// Basic Usage:
+//
+//	client, err := awn.NewClientWithOptions(url, version, awn.ClientOptions{RetryCount: 1})
+func NewClientWithOptions(url string, version string, opts ClientOptions) (*Client, error) {
+	opts = opts.withDefaults()
+
+	restyClient, err := CreateAwnClientWithOptions(url, version, opts)
+	if err != nil {
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		wrappedErr := fmt.Errorf("unable to create client: %w", err)
+		return nil, wrappedErr
+	}
+
+	return &Client{Client: restyClient, limiter: opts.RateLimiter, version: version}, nil
+}
+
+// Config is a public method that returns the effective configuration of the Client as
+// a ClientConfig. Since the values are read from the underlying resty client, any
+// changes made to it after creation are reflected as well. This is useful for
+// introspection and for comparing two clients in tests.
+//
+// Basic Usage:
+//
+//	if client.Config() != otherClient.Config() {
+//		// the clients are configured differently
+//	}
+func (c *Client) Config() ClientConfig {
+	return ClientConfig{
+		BaseURL:          c.BaseURL,
+		Version:          c.version,
+		RetryCount:       c.RetryCount,
+		RetryMinWaitTime: c.RetryWaitTime,
+		RetryMaxWaitTime: c.RetryMaxWaitTime,
+		Timeout:          c.GetClient().Timeout,
+		Debug:            c.Debug,
+		RateLimit:        c.limiter.Limit(),
+	}
+}
+
 // CreateAPIConfig is a public helper function that is used to create the FunctionData
 // struct, which is passed to the data gathering functions. It takes as parameters the
-// API key as "api" and the Application key as "app" and returns a pointer to a
-// FunctionData object.
+// API key as "api" and the Application key as "app", along with any additional API keys,
+// and returns a pointer to a FunctionData object. GetLatestData aggregates the devices of
+// every API key.
 //
 // Basic Usage:
 //
 //	apiConfig := awn.CreateApiConfig("apiTokenHere", "appTokenHere")
-func CreateAPIConfig(api string, app string) *FunctionData {
+//	apiConfig := awn.CreateApiConfig("apiTokenHere", "appTokenHere", "otherApiTokenHere")
+func CreateAPIConfig(api string, app string, moreAPIKeys ...string) *FunctionData {
 	fd := NewFunctionData()
 	fd.API = api
 	fd.App = app
 
+	if len(moreAPIKeys) > 0 {
+		fd.APIKeys = moreAPIKeys
+	}
+
 	return fd
 }
 
+// CreateAPIConfigFromEnv is a public helper function that works like CreateAPIConfig, but
+// reads the API key and the Application key from the environment variables with the
+// given names. It returns ErrAPIKeyMissing or ErrAppKeyMissing if either variable is
+// empty or not set, rather than a FunctionData that only fails once it is used.
+//
+// Basic Usage:
+//
+//	apiConfig, err := awn.CreateAPIConfigFromEnv("AWN_API_KEY", "AWN_APP_KEY")
+func CreateAPIConfigFromEnv(apiKeyVar string, appKeyVar string) (*FunctionData, error) {
+	api := GetEnvVar(apiKeyVar)
+	if api == "" {
+		getLogger().Error("api key environment variable is empty or not set", "variable", apiKeyVar)
+		return nil, ErrAPIKeyMissing
+	}
+
+	app := GetEnvVar(appKeyVar)
+	if app == "" {
+		getLogger().Error("application key environment variable is empty or not set", "variable", appKeyVar)
+		return nil, ErrAppKeyMissing
+	}
+
+	return CreateAPIConfig(api, app), nil
+}
+
 // CheckResponse is a public function that will take an API response and evaluate it
 // for any errors that might have occurred. The API specification does not publish all
 // the possible error messages, but these are what I have found so far. It returns a
-// boolean that indicates if the response has an error or not and an error message, if
-// applicable.
+// boolean that indicates if the response is free of errors and a typed error message,
+// if applicable. An unrecognized error message returns false and a nil error.
 //
-// This is not currently implemented.
+// Basic Usage:
+//
+//	ok, err := awn.CheckResponse(map[string]string{"error": "apiKey-missing"})
 func CheckResponse(resp map[string]string) (bool, error) {
 	message, ok := resp["error"]
 	if ok {
 		switch message {
 		case "apiKey-missing":
-			log.Panicf("API key is missing (%v). Visit https://ambientweather.net/account", message)
 			return false, ErrAPIKeyMissing
 		case "applicationKey-missing":
-			log.Panicf("App key is missing (%v). Visit https://ambientweather.net/account", message)
 			return false, ErrAppKeyMissing
 		case "date-invalid":
-			log.Panicf("Date is invalid (%v). It should be in epoch time in milliseconds", message)
 			return false, ErrInvalidDateFormat
 		case "macAddress-missing":
-			log.Panicf("MAC address is missing (%v). Supply a valid MAC address for a weather station", message)
 			return false, ErrMacAddressMissing
 		default:
 			return false, nil
@@ -182,50 +519,288 @@ func CheckResponse(resp map[string]string) (bool, error) {
 	return true, nil
 }
 
+// checkErrorEnvelope is a private helper function that inspects the raw body of an API
+// response. When the API rejects a request, it returns an error envelope such as
+// {"error":"apiKey-missing"} instead of the expected data. If the body matches that
+// shape, it is passed through CheckResponse and the resulting typed error is returned,
+// or ErrUnknownAPIError if CheckResponse does not know the message.
+func checkErrorEnvelope(body []byte) error {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil
+	}
+
+	var envelope struct {
+		Error string `json:"error"`
+	}
+
+	err := json.Unmarshal(trimmed, &envelope)
+	if err != nil || envelope.Error == "" {
+		return nil //nolint:nilerr
+	}
+
+	ok, err := CheckResponse(map[string]string{"error": envelope.Error})
+	if ok {
+		return nil
+	}
+
+	if err == nil {
+		err = ErrUnknownAPIError.withDetail("%v", envelope.Error)
+	}
+
+	return err
+}
+
+// checkDevicesObject is a private helper function that returns ErrUnknownAPIError if
+// body is a JSON object. The devicesEndpoint endpoint always returns a list of devices,
+// even an empty one, so an object is an error envelope that checkErrorEnvelope did not
+// recognize, such as one with a "message" but no "error". Without this check, it would
+// fail to decode into an AmbientDevice with an error that does not say why.
+func checkDevicesObject(body []byte) error {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil
+	}
+
+	return ErrUnknownAPIError.withDetail("%s", trimmed)
+}
+
+// checkStatus is a private helper function that returns ErrUnexpectedStatus, carrying
+// the status code, if resp has a status code of 400 or more. It is meant to be called
+// after checkErrorEnvelope, which returns a more specific error for the rejections that
+// the API explains in its body. A status code that is retried, such as a 500, only ends
+// up here once the retries have run out.
+func checkStatus(resp *resty.Response) error {
+	if resp.StatusCode() < http.StatusBadRequest {
+		return nil
+	}
+
+	return ErrUnexpectedStatus.with(resp.StatusCode())
+}
+
+// checkDevicesResponse is a private helper function that returns
+// ErrUnexpectedDevicesResponse if body holds the list of devices that the devicesEndpoint
+// endpoint returns, rather than the weather records of a single device. The API returns
+// the list when the MAC address is missing from the path, and it would otherwise decode
+// into records with every field left empty. Only the first element is decoded, since
+// every element of either list has the same shape.
+func checkDevicesResponse(body []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+
+	token, err := decoder.Token()
+	if err != nil || token != json.Delim('[') || !decoder.More() {
+		return nil //nolint:nilerr
+	}
+
+	var first map[string]json.RawMessage
+
+	err = decoder.Decode(&first)
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	_, hasMac := first["macAddress"]
+	_, hasInfo := first["info"]
+
+	if hasMac || hasInfo {
+		return ErrUnexpectedDevicesResponse
+	}
+
+	return nil
+}
+
+// requestError is a private helper function that converts an error returned by a
+// request to the devicesEndpoint into the error that is returned to the caller. Only an
+// error that was caused by the context being cancelled or timing out becomes
+// ErrContextTimeoutExceeded. Anything else, like a refused connection, is wrapped and
+// returned as-is, even if the context happened to expire around the same time.
+func requestError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		getLogger().Error("context ended while getting data", "endpoint", devicesEndpoint, "error", err)
+		return ErrContextTimeoutExceeded
+	}
+
+	getLogger().Error("unable to get data", "endpoint", devicesEndpoint, "error", err)
+
+	return fmt.Errorf("unable to get data from devicesEndpoint: %w", err)
+}
+
+// contextError is a private helper function that returns err as
+// ErrContextTimeoutExceeded if it was caused by the end of ctx, or nil if it was not.
+// Errors that end up wrapping a context error, such as one from the rate limiter, are
+// not recognized by requestError, so ctx itself is checked as well.
+func contextError(ctx context.Context, err error) error {
+	if errors.Is(err, ErrContextTimeoutExceeded) {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return ErrContextTimeoutExceeded.withDetail("%w", err)
+	}
+
+	return nil
+}
+
+// partialResult is a private helper function that returns what the historical data
+// functions return when fetchPages fails with err. The data fetched so far is kept if ctx
+// ended, in which case the error is ErrContextTimeoutExceeded, or if continueOnError is
+// set. Otherwise, no data is returned.
+func partialResult[T any](ctx context.Context, data []T, err error, continueOnError bool) ([]T, error) {
+	ctxErr := contextError(ctx, err)
+	if ctxErr != nil {
+		return data, fmt.Errorf("unable to get device data: %w", ctxErr)
+	}
+
+	wrappedErr := fmt.Errorf("unable to get device data: %w", err)
+	if continueOnError {
+		return data, wrappedErr
+	}
+
+	return nil, wrappedErr
+}
+
 // GetLatestData is a public function that takes a context object, a FunctionData object, a
 // URL and an API version route as inputs. It then creates an AwnClient and sets the
 // appropriate query parameters for authentication, makes the request to the
 // devicesEndpoint endpoint and marshals the response data into a pointer to an
 // AmbientDevice object, which is returned along with any error message.
 //
-// This function can be used to get the latest data from the Ambient Weather Network API.
-// But, it is generally used to get the MAC address of the weather station that you would
-// like to get historical data from.
+// This function can be used to get the latest data from the Ambient Weather Network API
+// for every weather station that the API key has access to, along with their names and
+// locations. But, it is generally used to get the MAC address of the weather station
+// that you would like to get historical data from. Any Option, such as
+// WithClientOptions, can be passed to change how the data is fetched.
+//
+// When the FunctionData holds additional APIKeys, one request is made per API key and the
+// devices are combined into a single AmbientDevice. A device that more than one API key
+// has access to is only returned once, the first time that its MAC address is seen.
 //
 // Basic Usage:
 //
 //	ctx := createContext()
 //	apiConfig := awn.CreateApiConfig(apiKey, appKey)
 //	data, err := awn.GetLatestData(ctx, ApiConfig, baseURL, apiVersion)
-func GetLatestData(ctx context.Context, funcData FunctionData, url string, version string) (*AmbientDevice, error) {
-	client, err := CreateAwnClient(url, version)
+func GetLatestData(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	opts ...Option) (*AmbientDevice, error) {
+	options := newFetchOptions(opts)
+
+	err := funcData.validateKeys()
+	if err != nil {
+		getLogger().Error("invalid function data", "endpoint", devicesEndpoint, "error", err)
+		return nil, err
+	}
+
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
 	if err != nil {
-		log.Printf("unable to create client")
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
 		wrappedErr := fmt.Errorf("unable to create client: %w", err)
 		return nil, wrappedErr
 	}
 
-	client.R().SetQueryParams(map[string]string{
-		"apiKey":         funcData.API,
-		"applicationKey": funcData.App,
-	})
+	devices := make(AmbientDevice, 0)
+	seen := make(map[string]struct{})
+
+	for _, apiKey := range funcData.apiKeys() {
+		keyData := funcData
+		keyData.API = apiKey
+
+		deviceData, err := getDevices(ctx, client, keyData, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, device := range deviceData {
+			if _, ok := seen[device.MacAddress]; ok {
+				continue
+			}
+
+			seen[device.MacAddress] = struct{}{}
+			devices = append(devices, device)
+		}
+	}
+
+	return &devices, nil
+}
 
-	deviceData := new(AmbientDevice)
+// authRequest is a private helper function that returns a new request of client for ctx,
+// carrying the API and Application keys of funcData. It is the one place where the keys
+// are added to a request, so every call to the API sends them the same way.
+func authRequest(ctx context.Context, client *resty.Client, funcData FunctionData) *resty.Request {
+	return client.R().
+		SetContext(ctx).
+		SetQueryParams(funcData.authParams())
+}
 
-	_, err = client.R().SetResult(deviceData).Get(devicesEndpoint)
+// getDevices is a private function that makes a single request to the devicesEndpoint
+// endpoint with the API and Application keys of funcData and returns the devices that the
+// API key has access to. The query parameters are set on the same request that is sent.
+func getDevices(
+	ctx context.Context,
+	client *resty.Client,
+	funcData FunctionData,
+	options fetchOptions) (AmbientDevice, error) {
+	resp, err := authRequest(ctx, client, funcData).
+		Get(devicesEndpoint)
 	if err != nil {
-		log.Printf("unable to get data from devicesEndpoint")
-		wrappedErr := fmt.Errorf("unable to get data from devicesEndpoint: %w", err)
-		return nil, wrappedErr
+		return nil, requestError(err)
+	}
+
+	if options.rawBody != nil {
+		options.rawBody(resp.Body())
+	}
+
+	err = checkErrorEnvelope(resp.Body())
+	if err != nil {
+		getLogger().Error("api returned an error", "endpoint", devicesEndpoint, "error", err)
+		return nil, err
+	}
+
+	err = checkStatus(resp)
+	if err != nil {
+		getLogger().Error("api rejected the request", "endpoint", devicesEndpoint, "error", err)
+		return nil, err
+	}
+
+	err = checkDevicesObject(resp.Body())
+	if err != nil {
+		getLogger().Error("api returned an error", "endpoint", devicesEndpoint, "error", err)
+		return nil, err
 	}
 
-	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-		return nil, errors.New("context timeout exceeded")
+	var deviceData AmbientDevice
+
+	err = options.unmarshal(resp.Body(), &deviceData)
+	if err != nil {
+		getLogger().Error("unable to unmarshal data", "endpoint", devicesEndpoint, "error", err)
+		wrappedErr := fmt.Errorf("unable to unmarshal data from devicesEndpoint: %w", partialResponse(resp.Body(), err))
+		return nil, wrappedErr
 	}
 
 	return deviceData, nil
 }
 
+// checkLimit is a private helper function that validates the limit of a FunctionData
+// against the range of the devices/macAddress endpoint, which is 1 to 288. A limit above
+// 288 is lowered to 288, since that is all the API returns anyway, and a limit below 1
+// returns ErrInvalidLimit.
+func checkLimit(limit int) (int, error) {
+	if limit < 1 {
+		getLogger().Error("invalid limit", "limit", limit)
+		return 0, ErrInvalidLimit.with(limit)
+	}
+
+	if limit > maxLimit {
+		getLogger().Warn("limit is above the maximum, lowering it", "limit", limit, "max", maxLimit)
+		return maxLimit, nil
+	}
+
+	return limit, nil
+}
+
 // getDeviceData is a private function takes a context object, a FunctionData object, a URL
 // for the Ambient Weather Network API and the API version route as inputs. It creates the
 // API client, then sets the query parameters for authentication and the maximum
@@ -234,7 +809,8 @@ func GetLatestData(ctx context.Context, funcData FunctionData, url string, versi
 // returned to the caller along with any errors.
 //
 // This function should be used if you are looking for weather data from a specific date
-// or time. The "limit" parameter can be a number from 1 to 288. You should discover how
+// or time. The "limit" parameter can be a number from 1 to 288. A larger limit is lowered
+// to 288 and a limit below 1 returns ErrInvalidLimit. You should discover how
 // often your weather station updates data in order to get a better understanding of how
 // many records will be fetched. For example, if your weather station updates every 5
 // minutes, then 288 will give you 24 hours of data. However, many people upload weather
@@ -245,113 +821,867 @@ func GetLatestData(ctx context.Context, funcData FunctionData, url string, versi
 //	ctx := createContext()
 //	apiConfig := awn.CreateApiConfig(apiKey, appKey)
 //	resp, err := getDeviceData(ctx, apiConfig)
-func getDeviceData(ctx context.Context, funcData FunctionData, url string, version string) (DeviceDataResponse, error) {
-	client, err := CreateAwnClient(url, version)
+func getDeviceData(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	opts ...Option) (DeviceDataResponse, error) {
+	limit, err := checkLimit(funcData.Limit)
 	if err != nil {
-		log.Printf("unable to create client")
-		return DeviceDataResponse{}, err
+		return nil, err
 	}
 
-	client.R().SetQueryParams(map[string]string{
-		"apiKey":         funcData.API,
-		"applicationKey": funcData.App,
-		"endDate":        strconv.FormatInt(funcData.Epoch, 10),
-		"limit":          strconv.Itoa(funcData.Limit),
-	})
+	funcData.Limit = limit
+	options := newFetchOptions(opts)
 
-	deviceData := new(DeviceDataResponse)
+	// the keys are taken from the pool, so only the MAC address is needed
+	validate := funcData.Validate
+	if options.keyPool != nil {
+		validate = funcData.validateMac
+	}
 
-	_, err = client.R().
-		SetPathParams(map[string]string{
-			"devicesEndpoint": devicesEndpoint,
-			"macAddress":      funcData.Mac,
-		}).
-		SetResult(deviceData).
-		Get("{devicesEndpoint}/{macAddress}")
+	err = validate()
+	if err != nil {
+		getLogger().Error("invalid function data", "mac", funcData.Mac, "error", err)
+		return nil, err
+	}
+
+	funcData.Mac, err = NormalizeMacAddress(funcData.Mac)
 	if err != nil {
-		log.Printf("unable to get data from devicesEndpoint")
-		wrappedErr := fmt.Errorf("unable to get data from devicesEndpoint: %w", err)
-		return DeviceDataResponse{}, wrappedErr
+		getLogger().Error("invalid mac address", "mac", funcData.Mac, "error", err)
+		return nil, err
 	}
 
-	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-		return DeviceDataResponse{}, ErrContextTimeoutExceeded //nolint:exhaustruct
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+	if err != nil {
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		return nil, err
 	}
 
-	return *deviceData, nil
+	return fetchDeviceData(ctx, client, funcData, options)
 }
 
-// GetHistoricalData is a public function that takes a context object, a FunctionData
-// object, the URL of the Ambient Weather Network API and the API version route as inputs
-// and returns a list of DeviceDataResponse objects and an error.
-//
-// This function is useful if you would like to retrieve data from some point in the past
-// until the present.
-//
-// Basic Usage:
-//
-//	ctx := createContext()
-//	apiConfig := awn.CreateApiConfig(apiKey, appKey)
-//	resp, err := GetHistoricalData(ctx, apiConfig)
-func GetHistoricalData(
+// fetchDeviceData is a private function that does the work for getDeviceData, but uses
+// an existing client. This allows a series of calls to share a single client and, more
+// importantly, its rate limiter.
+func fetchDeviceData(
 	ctx context.Context,
+	client *resty.Client,
 	funcData FunctionData,
-	url string,
-	version string) ([]DeviceDataResponse, error) {
-	var deviceResponse []DeviceDataResponse
-
-	for i := funcData.Epoch; i <= time.Now().UnixMilli(); i += epochIncrement24h {
-		funcData.Epoch = i
+	options fetchOptions) (DeviceDataResponse, error) {
+	if options.keyPool != nil {
+		keys := options.keyPool.Next()
+		funcData.API, funcData.App = keys.API, keys.App
+	}
 
-		resp, err := getDeviceData(ctx, funcData, url, version)
-		if err != nil {
-			log.Printf("unable to get device data")
-			wrappedErr := fmt.Errorf("unable to get device data: %w", err)
-			return nil, wrappedErr
+	resp, err := authRequest(ctx, client, funcData).
+		SetQueryParams(map[string]string{
+			"endDate": strconv.FormatInt(funcData.Epoch, 10),
+			"limit":   strconv.Itoa(funcData.Limit),
+		}).
+		SetPathParams(map[string]string{
+			"devicesEndpoint": devicesEndpoint,
+			"macAddress":      funcData.Mac,
+		}).
+		Get("/{devicesEndpoint}/{macAddress}")
+	if err != nil {
+		return nil, requestError(err)
+	}
+
+	if options.rawBody != nil {
+		options.rawBody(resp.Body())
+	}
+
+	err = checkErrorEnvelope(resp.Body())
+	if err != nil {
+		getLogger().Error("api returned an error", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"epoch", funcData.Epoch, "error", err)
+		return nil, err
+	}
+
+	err = checkStatus(resp)
+	if err != nil {
+		getLogger().Error("api rejected the request", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"epoch", funcData.Epoch, "error", err)
+		return nil, err
+	}
+
+	err = checkDevicesResponse(resp.Body())
+	if err != nil {
+		getLogger().Error("api returned a list of devices", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"epoch", funcData.Epoch, "error", err)
+		return nil, err
+	}
+
+	deviceData, err := decodeDeviceData(resp.Body(), options)
+	if err != nil {
+		getLogger().Error("unable to decode data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"epoch", funcData.Epoch, "error", err)
+		wrappedErr := fmt.Errorf("unable to decode data from devicesEndpoint: %w", err)
+		return nil, wrappedErr
+	}
+
+	return deviceData, nil
+}
+
+// GetMostRecent is a public function that takes a context object, a FunctionData object,
+// the MAC address of a weather station, the URL of the Ambient Weather Network API and
+// the API version route as inputs. It asks the devices/macAddress endpoint for a single
+// record and returns the most recent WeatherRecord of the weather station. Unlike
+// GetLatestData, every field has its full precision. The Epoch, Limit and Mac fields of
+// funcData are ignored.
+//
+// Basic Usage:
+//
+//	ctx := createContext()
+//	apiConfig := awn.CreateApiConfig(apiKey, appKey)
+//	record, err := awn.GetMostRecent(ctx, *apiConfig, "00:11:22:33:44:55", url, version)
+func GetMostRecent(
+	ctx context.Context,
+	funcData FunctionData,
+	mac string,
+	url string,
+	version string,
+	opts ...Option) (WeatherRecord, error) {
+	funcData.Epoch = newFetchOptions(opts).clock.Now().UnixMilli()
+	funcData.Limit = 1
+	funcData.Mac = mac
+
+	resp, err := getDeviceData(ctx, funcData, url, version, opts...)
+	if err != nil {
+		return WeatherRecord{}, err //nolint:exhaustruct
+	}
+
+	if len(resp) == 0 {
+		getLogger().Error("no records returned", "endpoint", devicesEndpoint, "mac", mac)
+		return WeatherRecord{}, fmt.Errorf("no records returned for %v", mac) //nolint:exhaustruct
+	}
+
+	return resp[0], nil
+}
+
+// withoutSeen is a private helper function that returns the records in d whose Dateutc
+// is not in seen, and adds them to seen. Consecutive windows can overlap when limit
+// records reach further back than the previous endDate, so this keeps a record from
+// being returned twice across a series of calls.
+func (d DeviceDataResponse) withoutSeen(seen map[int64]struct{}) DeviceDataResponse {
+	unseen := make(DeviceDataResponse, 0, len(d))
+
+	for _, record := range d {
+		if _, ok := seen[record.Dateutc]; ok {
+			continue
 		}
 
-		deviceResponse = append(deviceResponse, resp)
+		seen[record.Dateutc] = struct{}{}
+		unseen = append(unseen, record)
+	}
+
+	return unseen
+}
+
+// fetchPages is a private function that pages backward through the device data of
+// funcData.Mac, from endDate down to startDate (both Unix epochs in milliseconds). Each
+// call asks for funcData.Limit records before the oldest record of the previous page, so
+// no records are skipped, no matter how often the weather station uploads data. Every
+// page is passed to yield, newest first, without the records that were already seen or
+// that are older than startDate. Paging stops when startDate is reached, when the API
+// runs out of records, or when yield returns false. With WithNoDataError, it returns
+// ErrNoDataForRange if not a single record was passed to yield. An endDate in the future
+// is clamped to the present, so the partial current day is always fetched exactly once.
+// funcData.Mac can be in any of the forms accepted by NormalizeMacAddress.
+//
+// By default, the first call that fails stops the paging. With WithContinueOnError, the
+// rest of the UTC day of a failed call is skipped instead, and every error is joined with
+// errors.Join and returned at the end. Paging always stops once ctx ends.
+func fetchPages(
+	ctx context.Context,
+	client *resty.Client,
+	funcData FunctionData,
+	startDate int64,
+	endDate int64,
+	options fetchOptions,
+	yield func(DeviceDataResponse) bool) error {
+	limit, err := checkLimit(funcData.Limit)
+	if err != nil {
+		return err
+	}
+
+	funcData.Limit = limit
+
+	funcData.Mac, err = NormalizeMacAddress(funcData.Mac)
+	if err != nil {
+		return err
+	}
+
+	endDate = min(endDate, options.clock.Now().UnixMilli())
+	seen := make(map[int64]struct{})
+	yielded := false
+
+	var errs []error
+
+	for endDate >= startDate {
+		funcData.Epoch = endDate
+
+		resp, err := fetchDeviceData(ctx, client, funcData, options)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to get device data before epoch %v: %w", endDate, err))
+			if !options.continueOnError || ctx.Err() != nil {
+				return errors.Join(errs...)
+			}
+
+			// skip to the start of the day that was being fetched
+			endDate = (endDate - 1) - (endDate-1)%epochIncrement24h
+
+			continue
+		}
+
+		if len(resp) == 0 {
+			break
+		}
+
+		oldest := resp[0].Dateutc
+		for _, record := range resp {
+			oldest = min(oldest, record.Dateutc)
+		}
+
+		page := resp
+		if !options.rawPages {
+			page = make(DeviceDataResponse, 0, len(resp))
+			for _, record := range resp.withoutSeen(seen) {
+				if record.Dateutc >= startDate {
+					page = append(page, record)
+				}
+			}
+		}
+
+		if len(page) > 0 {
+			yielded = true
+			if !yield(page) {
+				return nil
+			}
+		}
+
+		if len(resp) < funcData.Limit {
+			break
+		}
+
+		// when the API includes records at endDate, a page full of them would keep
+		// coming back, so step past it instead
+		endDate = min(oldest, endDate-1)
+	}
+
+	if options.noDataError && !yielded {
+		errs = append(errs, ErrNoDataForRange)
+	}
+
+	return errors.Join(errs...)
+}
+
+// GetHistoricalData is a public function that takes a context object, a FunctionData
+// object, the URL of the Ambient Weather Network API and the API version route as inputs
+// and returns a list of DeviceDataResponse objects and an error.
+//
+// The data comes back newest first. Earlier versions walked forward one day at a time
+// and returned the oldest day first; use slices.Reverse on the result if you need that
+// order.
+//
+// This function is useful if you would like to retrieve data from some point in the past
+// (funcData.Epoch) until the present. The data is fetched in pages of funcData.Limit
+// records, from the newest to the oldest, and each page is one DeviceDataResponse in the
+// returned list. Every call shares a single client, so they are paced by its rate
+// limiter. Any Option, such as WithFields, can be passed to change how the data is
+// fetched. A record is only returned once, even when two pages overlap on the record at
+// their boundary or a call is retried, so the records run from the newest to the oldest
+// with no duplicate Dateutc. Pass WithRawPages to get the pages as the API sent them.
+//
+// If ctx is canceled or times out part of the way through, the pages that were already
+// fetched are returned along with ErrContextTimeoutExceeded, so a long pull can be cut
+// short without losing its data. Any other error returns no data, unless
+// WithContinueOnError is passed, in which case a failed call only loses the rest of its
+// day, and the data is returned along with every error.
+//
+// Basic Usage:
+//
+//	ctx := createContext()
+//	apiConfig := awn.CreateApiConfig(apiKey, appKey)
+//	resp, err := GetHistoricalData(ctx, apiConfig)
+func GetHistoricalData(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	opts ...Option) ([]DeviceDataResponse, error) {
+	options := newFetchOptions(opts)
+
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+	if err != nil {
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		wrappedErr := fmt.Errorf("unable to create client: %w", err)
+		return nil, wrappedErr
+	}
+
+	var deviceResponse []DeviceDataResponse
+
+	err = fetchPages(ctx, client, funcData, funcData.Epoch, options.clock.Now().UnixMilli(), options,
+		func(page DeviceDataResponse) bool {
+			deviceResponse = append(deviceResponse, page)
+			return true
+		})
+	if err != nil {
+		getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"error", err)
+
+		return partialResult(ctx, deviceResponse, err, options.continueOnError)
 	}
 
 	return deviceResponse, nil
 }
 
+// EstimateHistoricalCalls is a public function that returns how many calls
+// GetHistoricalData makes to fetch the data from start until now, with pages of limit
+// records. It assumes that the weather station uploaded every 5 minutes the whole time,
+// which is the most the API keeps, so the real number can only be lower. Since each API
+// key is allowed one call per second, it is also about how many seconds the fetch takes,
+// which helps to decide how to split up a long backfill. A limit above 288 counts as
+// 288, and a limit below 1, or a start in the future, needs no calls at all.
+//
+// Basic Usage:
+//
+//	calls := awn.EstimateHistoricalCalls(time.Now().AddDate(0, -6, 0), 288)
+//	fmt.Printf("this will take about %v\n", time.Duration(calls)*time.Second)
+func EstimateHistoricalCalls(start time.Time, limit int) int {
+	return estimateHistoricalCalls(start, time.Now(), limit)
+}
+
+// estimateHistoricalCalls is a private helper function that works like
+// EstimateHistoricalCalls, but until end instead of now. Every page but the last is
+// full, and the last one is either short or, when the records fill the pages exactly,
+// empty, so there is always one call more than there are full pages.
+func estimateHistoricalCalls(start time.Time, end time.Time, limit int) int {
+	if limit < 1 || start.After(end) {
+		return 0
+	}
+
+	records := end.Sub(start).Milliseconds() / recordIntervalMillis
+
+	return int(records/int64(min(limit, maxLimit))) + 1
+}
+
+// GetHistoricalDataProjected is a public function that works like GetHistoricalData,
+// but only keeps the given fields of each record, using their JSON names (i.e. "tempf"
+// or "humidity"), and returns the records as maps from those names to their values,
+// from the newest to the oldest. Only one page of full WeatherRecord objects is held at a
+// time, so a pull of hundreds of thousands of records that only needs a few fields takes
+// a fraction of the memory. The values keep the type of their WeatherRecord field, so
+// "tempf" is a float64 and "humidity" an int, and a sensor that did not report is left
+// out of the map. It returns ErrUnknownField if a field is not a WeatherRecord field, or
+// if no fields are given.
+//
+// Basic Usage:
+//
+//	records, err := awn.GetHistoricalDataProjected(ctx, funcData, url, version,
+//		[]string{"dateutc", "tempf", "humidity"})
+//	fmt.Println(records[0]["tempf"])
+func GetHistoricalDataProjected(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	fields []string,
+	opts ...Option) ([]map[string]any, error) {
+	indexes, err := projectionIndexes(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	options := newFetchOptions(append(opts, WithFields(fields)))
+
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+	if err != nil {
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		wrappedErr := fmt.Errorf("unable to create client: %w", err)
+		return nil, wrappedErr
+	}
+
+	var projected []map[string]any
+
+	err = fetchPages(ctx, client, funcData, funcData.Epoch, options.clock.Now().UnixMilli(), options,
+		func(page DeviceDataResponse) bool {
+			for _, record := range page {
+				projected = append(projected, projectRecord(record, indexes))
+			}
+
+			return true
+		})
+	if err != nil {
+		getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"error", err)
+
+		return partialResult(ctx, projected, err, options.continueOnError)
+	}
+
+	return projected, nil
+}
+
+// GetHistoricalDataBetween is a public function that works like GetHistoricalData, but
+// only fetches the data between two dates, formatted as YYYY-MM-DD. Both days are
+// included, so a start of "2023-07-01" and an end of "2023-07-31" returns all of July
+// 2023. The dates are in UTC. It returns ErrInvalidDateRange if start is after end. Like
+// GetHistoricalData, it returns the pages fetched so far if ctx ends first, and honors
+// WithContinueOnError.
+//
+// Basic Usage:
+//
+//	ctx := createContext()
+//	apiConfig := awn.CreateApiConfig(apiKey, appKey)
+//	resp, err := GetHistoricalDataBetween(ctx, *apiConfig, url, version, "2023-07-01", "2023-07-31")
+func GetHistoricalDataBetween(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	start YearMonthDay,
+	end YearMonthDay,
+	opts ...Option) ([]DeviceDataResponse, error) {
+	startDate, err := ConvertTimeToEpoch(start.String())
+	if err != nil {
+		return nil, err
+	}
+
+	endDate, err := ConvertTimeToEpoch(end.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if startDate > endDate {
+		getLogger().Error("start date is after end date", "start", start, "end", end)
+		return nil, ErrInvalidDateRange.withDetail("%v is after %v", start, end)
+	}
+
+	options := newFetchOptions(opts)
+
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+	if err != nil {
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		wrappedErr := fmt.Errorf("unable to create client: %w", err)
+		return nil, wrappedErr
+	}
+
+	var deviceResponse []DeviceDataResponse
+
+	// the end day is included, so the last page ends at midnight of the day after
+	err = fetchPages(ctx, client, funcData, startDate, endDate+epochIncrement24h, options,
+		func(page DeviceDataResponse) bool {
+			deviceResponse = append(deviceResponse, page)
+			return true
+		})
+	if err != nil {
+		getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"error", err)
+
+		return partialResult(ctx, deviceResponse, err, options.continueOnError)
+	}
+
+	return deviceResponse, nil
+}
+
+// GetDataSince is a public function that returns every record of funcData.Mac that is
+// newer than since, up to the present, from the oldest to the newest. since is usually
+// the Date of the newest record of the previous call, so the last record returned is the
+// cursor for the next one. The record at since itself is not returned again, and only
+// the pages needed to reach since are fetched, rather than whole days. funcData.Epoch is
+// not used. Like GetHistoricalData, it takes any Option, and it returns the records
+// fetched so far if ctx ends first.
+//
+// Basic Usage:
+//
+//	records, err := awn.GetDataSince(ctx, funcData, url, version, lastSeen)
+//	if err == nil && len(records) > 0 {
+//		lastSeen = records[len(records)-1].Date
+//	}
+func GetDataSince(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	since time.Time,
+	opts ...Option) ([]WeatherRecord, error) {
+	options := newFetchOptions(opts)
+
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+	if err != nil {
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		wrappedErr := fmt.Errorf("unable to create client: %w", err)
+		return nil, wrappedErr
+	}
+
+	var records DeviceDataResponse
+
+	// the record at since was already seen, so the range starts just after it
+	err = fetchPages(ctx, client, funcData, since.UnixMilli()+1, options.clock.Now().UnixMilli(), options,
+		func(page DeviceDataResponse) bool {
+			records = append(records, page...)
+			return true
+		})
+	if err != nil {
+		getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"since", since, "error", err)
+
+		return partialResult(ctx, records.chronological(), err, options.continueOnError)
+	}
+
+	return records.chronological(), nil
+}
+
+// GetHistoricalDataForDevices is a public function that works like GetHistoricalData, but
+// fetches the data of every weather station in macs, with up to concurrency of them at
+// a time. The Mac field of funcData is ignored. Every call shares a single client, so
+// they are all paced by its rate limiter, no matter how many run at once. The records of
+// each weather station are returned in a single list, from the newest to the oldest,
+// keyed by its MAC address.
+//
+// A weather station that fails does not stop the others. Its MAC address is left out of
+// the returned map and its error, which names the MAC address, is joined with those of
+// the other failed weather stations into the returned error. A concurrency of less than
+// 1 fetches one weather station at a time.
+//
+// Basic Usage:
+//
+//	ctx := createContext()
+//	apiConfig := awn.CreateApiConfig(apiKey, appKey)
+//	data, err := awn.GetHistoricalDataForDevices(ctx, *apiConfig, url, version, macs, 4)
+func GetHistoricalDataForDevices(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	macs []string,
+	concurrency int,
+	opts ...Option) (map[string][]WeatherRecord, error) {
+	options := newFetchOptions(opts)
+
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+	if err != nil {
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		wrappedErr := fmt.Errorf("unable to create client: %w", err)
+		return nil, wrappedErr
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+
+	data := make(map[string][]WeatherRecord, len(macs))
+	work := make(chan string)
+
+	for i := 0; i < max(concurrency, 1); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for mac := range work {
+				deviceData := funcData
+				deviceData.Mac = mac
+
+				var records []WeatherRecord
+
+				err := fetchPages(ctx, client, deviceData, deviceData.Epoch, options.clock.Now().UnixMilli(), options,
+					func(page DeviceDataResponse) bool {
+						records = append(records, page...)
+						return true
+					})
+
+				mu.Lock()
+				if err != nil {
+					getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", mac,
+						"error", err)
+					errs = append(errs, fmt.Errorf("unable to get device data for %v: %w", mac, err))
+				} else {
+					data[mac] = records
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, mac := range macs {
+		work <- mac
+	}
+
+	close(work)
+	wg.Wait()
+
+	return data, errors.Join(errs...)
+}
+
 // GetHistoricalDataAsync is a public function that takes a context object, a FunctionData
 // object, the URL of the Ambient Weather Network API, the version route of the API and a
-// WaitGroup object as inputs. It will return a channel of DeviceDataResponse
-// objects and an error status.
+// WaitGroup object as inputs. It will return a channel of DeviceDataResult objects and an
+// error status. Each DeviceDataResult carries one page of data, from the newest to the
+// oldest, just like GetHistoricalData. If a page cannot be fetched, a final
+// DeviceDataResult carrying the error is sent and the channel is closed, so a channel
+// that closes without an error means that every page was fetched. Like
+// GetHistoricalData, every call shares a single client and its rate limiter, and a record
+// is only sent once. Any Option, such as WithFields, can be passed to change how the
+// data is fetched.
+//
+// By default, the pages are fetched one after the other. With WithConcurrency, the range
+// is split into UTC days instead, and up to n days are fetched at once, still through the
+// rate limiter. The pages are sent in the same order either way, newest first, since a
+// day that is fetched early waits for the newer ones to be sent.
+//
+// The caller must call w.Add(1) before calling this function. w.Done() is called once
+// the last result has been sent and the channel has been closed, so w.Wait() can be used
+// to know when the fetch has completed. Once ctx is cancelled, nothing more is sent, so
+// the caller may cancel it and stop reading from the channel.
 //
 // Basic Usage:
 //
 //	ctx := createContext()
-//	outChannel, err := awn.GetHistoricalDataAsync(ctx, functionData, *sync.WaitGroup)
+//	var wg sync.WaitGroup
+//	wg.Add(1)
+//	outChannel, err := awn.GetHistoricalDataAsync(ctx, functionData, url, version, &wg)
+//	for result := range outChannel {
+//		if result.Err != nil {
+//			// the stream stopped early
+//		}
+//	}
 func GetHistoricalDataAsync(
 	ctx context.Context,
 	funcData FunctionData,
 	url string,
 	version string,
-	w *sync.WaitGroup) (<-chan DeviceDataResponse, error) {
-	defer w.Done()
+	w *sync.WaitGroup,
+	opts ...Option) (<-chan DeviceDataResult, error) {
+	options := newFetchOptions(opts)
+
+	client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+	if err != nil {
+		w.Done()
+		getLogger().Error("unable to create client", "url", url+version, "error", err)
+		wrappedErr := fmt.Errorf("unable to create client: %w", err)
+		return nil, wrappedErr
+	}
 
-	out := make(chan DeviceDataResponse)
+	out := make(chan DeviceDataResult, options.channelBuffer)
 
 	go func() {
+		defer w.Done()
 		defer close(out)
 
-		for i := funcData.Epoch; i <= time.Now().UnixMilli(); i += epochIncrement24h {
-			funcData.Epoch = i
+		if options.concurrency > 1 {
+			windows := dayWindows(funcData.Epoch, options.clock.Now().UnixMilli())
+			fetchDaysConcurrently(ctx, client, funcData, windows, options, out)
+			return
+		}
 
-			resp, err := getDeviceData(ctx, funcData, url, version)
-			if err != nil {
-				log.Printf("unable to get device data: %v", err)
-				break
+		err := fetchPages(ctx, client, funcData, funcData.Epoch, options.clock.Now().UnixMilli(), options,
+			func(page DeviceDataResponse) bool {
+				return sendResult(ctx, out, DeviceDataResult{Data: page, Err: nil})
+			})
+		if err != nil {
+			getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+				"epoch", funcData.Epoch, "error", err)
+			sendResult(ctx, out, DeviceDataResult{Data: nil, Err: err})
+		}
+	}()
+
+	return out, nil
+}
+
+// dayWindow is a private struct that holds the range of a single UTC day, or of part of
+// one, as Unix epochs in milliseconds. start is included and end is not.
+type dayWindow struct {
+	start int64
+	end   int64
+}
+
+// dayWindows is a private helper function that splits the range from startDate to
+// endDate into UTC days, from the newest to the oldest. The first and the last day are
+// cut short to fit the range.
+func dayWindows(startDate int64, endDate int64) []dayWindow {
+	var windows []dayWindow
+
+	for end := endDate; end > startDate; {
+		start := max((end-1)-(end-1)%epochIncrement24h, startDate)
+		windows = append(windows, dayWindow{start: start, end: end})
+		end = start
+	}
+
+	return windows
+}
+
+// dayResult is a private struct that holds the pages of a dayWindow, and the error that
+// stopped its fetch, if any.
+type dayResult struct {
+	index int
+	pages []DeviceDataResponse
+	err   error
+}
+
+// fetchDay is a private function that fetches every page of a single dayWindow.
+func fetchDay(
+	ctx context.Context,
+	client *resty.Client,
+	funcData FunctionData,
+	window dayWindow,
+	options fetchOptions) dayResult {
+	// an empty day is not an error on its own, only an empty range is
+	options.noDataError = false
+
+	var pages []DeviceDataResponse
+
+	err := fetchPages(ctx, client, funcData, window.start, window.end, options,
+		func(page DeviceDataResponse) bool {
+			kept := page
+			if !options.rawPages {
+				kept = make(DeviceDataResponse, 0, len(page))
+				for _, record := range page {
+					if record.Dateutc < window.end {
+						kept = append(kept, record)
+					}
+				}
 			}
 
-			out <- resp
+			if len(kept) > 0 {
+				pages = append(pages, kept)
+			}
+
+			return true
+		})
+	if err != nil {
+		getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+			"start", window.start, "end", window.end, "error", err)
+	}
+
+	return dayResult{index: 0, pages: pages, err: err}
+}
+
+// fetchDaysConcurrently is a private function that fetches the windows with up to
+// options.concurrency of them in flight at once, and sends their pages on out in the
+// order of windows. A window can only start once there is a free slot, and a slot is only
+// freed when its window has been sent, so no more than options.concurrency windows are
+// ever held in memory while waiting for an older one. The first error is sent after the
+// pages of the windows before it, and stops the fetch unless WithContinueOnError is set.
+// Once ctx ends, nothing more is sent, so the caller may stop reading from out.
+func fetchDaysConcurrently(
+	ctx context.Context,
+	client *resty.Client,
+	funcData FunctionData,
+	windows []dayWindow,
+	options fetchOptions,
+	out chan<- DeviceDataResult) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slots := make(chan struct{}, options.concurrency)
+	jobs := make(chan int)
+
+	go func() {
+		defer close(jobs)
+
+		for i := range windows {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
-	return out, nil
+	results := make(chan dayResult, options.concurrency)
+
+	var workers sync.WaitGroup
+
+	for n := 0; n < options.concurrency; n++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for i := range jobs {
+				result := fetchDay(ctx, client, funcData, windows[i], options)
+				result.index = i
+				results <- result
+			}
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]dayResult, options.concurrency)
+	next := 0
+	yielded := false
+
+	for result := range results {
+		pending[result.index] = result
+
+		for ; ; next++ {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+			<-slots
+
+			for _, page := range result.pages {
+				yielded = true
+
+				if !sendResult(ctx, out, DeviceDataResult{Data: page, Err: nil}) {
+					cancel()
+					go drainResults(results)
+					return
+				}
+			}
+
+			if result.err != nil {
+				sent := sendResult(ctx, out, DeviceDataResult{Data: nil, Err: result.err})
+
+				if !sent || !options.continueOnError || ctx.Err() != nil {
+					cancel()
+					go drainResults(results)
+					return
+				}
+			}
+		}
+	}
+
+	if options.noDataError && !yielded {
+		sendResult(ctx, out, DeviceDataResult{Data: nil, Err: ErrNoDataForRange})
+	}
+}
+
+// sendResult is a private helper function that sends result on out, unless ctx ends
+// first, so that a caller that cancels and stops reading does not leave the sender
+// blocked forever. It reports whether result was sent.
+func sendResult(ctx context.Context, out chan<- DeviceDataResult, result DeviceDataResult) bool {
+	select {
+	case out <- result:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// drainResults is a private helper function that reads from results until it is closed,
+// so that the workers of fetchDaysConcurrently can exit once it has stopped reading.
+func drainResults(results <-chan dayResult) {
+	for range results { //nolint:revive
+	}
 }
 
 // GetEnvVars is a public function that will attempt to read the environment variables that
@@ -366,7 +1696,7 @@ func GetEnvVars(vars []string) map[string]string {
 	for v := range vars {
 		value := GetEnvVar(vars[v])
 		if value == "" {
-			log.Printf("environment variable %v is empty or not set", vars[v])
+			getLogger().Warn("environment variable is empty or not set", "variable", vars[v])
 		}
 		envVars[vars[v]] = value
 	}
@@ -0,0 +1,749 @@
+package awn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
+)
+
+func TestCreateAwnClientWithOptions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		opts ClientOptions
+		want ClientConfig
+	}{
+		{name: "TestZeroValueFallsBackToDefaults", opts: ClientOptions{}, want: ClientConfig{
+			BaseURL:          "http://127.0.0.1/v1",
+			Version:          "/v1",
+			RetryCount:       retryCount,
+			RetryMinWaitTime: retryMinWaitTimeSeconds * time.Second,
+			RetryMaxWaitTime: retryMaxWaitTimeSeconds * time.Second,
+			Timeout:          defaultCtxTimeout * time.Second,
+			Debug:            debugMode,
+			RateLimit:        defaultRequestsPerSecond,
+		}},
+		{name: "TestOverriddenValues", opts: ClientOptions{
+			RetryCount:       1,
+			RetryMinWaitTime: 100 * time.Millisecond,
+			RetryMaxWaitTime: time.Second,
+			Timeout:          2 * time.Second,
+			Debug:            true,
+		}, want: ClientConfig{
+			BaseURL:          "http://127.0.0.1/v1",
+			Version:          "/v1",
+			RetryCount:       1,
+			RetryMinWaitTime: 100 * time.Millisecond,
+			RetryMaxWaitTime: time.Second,
+			Timeout:          2 * time.Second,
+			Debug:            true,
+			RateLimit:        defaultRequestsPerSecond,
+		}},
+		{name: "TestPartialOverride", opts: ClientOptions{Timeout: 500 * time.Millisecond}, want: ClientConfig{
+			BaseURL:          "http://127.0.0.1/v1",
+			Version:          "/v1",
+			RetryCount:       retryCount,
+			RetryMinWaitTime: retryMinWaitTimeSeconds * time.Second,
+			RetryMaxWaitTime: retryMaxWaitTimeSeconds * time.Second,
+			Timeout:          500 * time.Millisecond,
+			Debug:            debugMode,
+			RateLimit:        defaultRequestsPerSecond,
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			restyClient, err := CreateAwnClientWithOptions("http://127.0.0.1", "/v1", tt.opts)
+			if err != nil {
+				t.Fatalf("CreateAwnClientWithOptions() error = %v", err)
+			}
+			if restyClient.RetryCount != tt.want.RetryCount {
+				t.Errorf("RetryCount = %v, want %v", restyClient.RetryCount, tt.want.RetryCount)
+			}
+			if restyClient.RetryWaitTime != tt.want.RetryMinWaitTime {
+				t.Errorf("RetryWaitTime = %v, want %v", restyClient.RetryWaitTime, tt.want.RetryMinWaitTime)
+			}
+			if restyClient.RetryMaxWaitTime != tt.want.RetryMaxWaitTime {
+				t.Errorf("RetryMaxWaitTime = %v, want %v", restyClient.RetryMaxWaitTime, tt.want.RetryMaxWaitTime)
+			}
+			if restyClient.GetClient().Timeout != tt.want.Timeout {
+				t.Errorf("Timeout = %v, want %v", restyClient.GetClient().Timeout, tt.want.Timeout)
+			}
+			if restyClient.Debug != tt.want.Debug {
+				t.Errorf("Debug = %v, want %v", restyClient.Debug, tt.want.Debug)
+			}
+
+			client, err := NewClientWithOptions("http://127.0.0.1", "/v1", tt.opts)
+			if err != nil {
+				t.Fatalf("NewClientWithOptions() error = %v", err)
+			}
+			if got := client.Config(); got != tt.want {
+				t.Errorf("Config() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testClientOptions is a helper function that returns ClientOptions suited for tests
+// against a local mock server: no rate limiting and short retry waits.
+func testClientOptions() ClientOptions {
+	return ClientOptions{
+		RetryMinWaitTime: 10 * time.Millisecond,
+		RetryMaxWaitTime: 50 * time.Millisecond,
+		RateLimiter:      rate.NewLimiter(rate.Inf, 0),
+	}
+}
+
+func TestFullJitterBackoff(t *testing.T) {
+	t.Parallel()
+	minWait, maxWait := 100*time.Millisecond, 2*time.Second
+	backoff := fullJitterBackoff(minWait, maxWait)
+
+	tests := []struct {
+		name    string
+		attempt int
+		ceiling time.Duration
+	}{
+		{"TestFirstAttempt", 1, 200 * time.Millisecond},
+		{"TestThirdAttempt", 3, 800 * time.Millisecond},
+		{"TestCappedAttempt", 10, maxWait},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resp := &resty.Response{Request: &resty.Request{Attempt: tt.attempt}} //nolint:exhaustruct
+
+			seen := make(map[time.Duration]struct{})
+			for i := 0; i < 200; i++ {
+				wait, err := backoff(nil, resp)
+				if err != nil {
+					t.Fatalf("backoff() error = %v", err)
+				}
+				if wait < minWait || wait > tt.ceiling {
+					t.Fatalf("backoff() = %v, want between %v and %v", wait, minWait, tt.ceiling)
+				}
+				seen[wait] = struct{}{}
+			}
+
+			// 200 samples from a range this wide should almost never repeat
+			if len(seen) < 100 {
+				t.Errorf("backoff() returned %v distinct waits out of 200, want them spread out", len(seen))
+			}
+		})
+	}
+}
+
+func TestHalfJitterBackoff(t *testing.T) {
+	t.Parallel()
+	minWait, maxWait := 100*time.Millisecond, 2*time.Second
+	backoff := halfJitterBackoff(minWait, maxWait)
+
+	tests := []struct {
+		name    string
+		attempt int
+		floor   time.Duration
+		ceiling time.Duration
+	}{
+		{"TestFirstAttempt", 1, minWait, minWait},
+		{"TestThirdAttempt", 3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"TestCappedAttempt", 10, maxWait / 2, maxWait},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resp := &resty.Response{Request: &resty.Request{Attempt: tt.attempt}} //nolint:exhaustruct
+
+			for i := 0; i < 200; i++ {
+				wait, err := backoff(nil, resp)
+				if err != nil {
+					t.Fatalf("backoff() error = %v", err)
+				}
+				if wait < tt.floor || wait > tt.ceiling {
+					t.Fatalf("backoff() = %v, want between %v and %v", wait, tt.floor, tt.ceiling)
+				}
+			}
+		})
+	}
+}
+
+func TestJitterOption(t *testing.T) {
+	t.Parallel()
+	for _, jitter := range []bool{false, true} {
+		client, err := CreateAwnClientWithOptions("http://127.0.0.1", "/v1", ClientOptions{Jitter: jitter})
+		if err != nil {
+			t.Fatalf("CreateAwnClientWithOptions() error = %v", err)
+		}
+		if got := client.RetryAfter != nil; got != jitter {
+			t.Errorf("Jitter = %v, but RetryAfter is set = %v", jitter, got)
+		}
+	}
+}
+
+func TestMaxRetryElapsedTime(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		jitter bool
+	}{
+		{"TestDefaultBackoff", false},
+		{"TestJitter", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var requests int32
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}))
+			defer s.Close()
+
+			budget := 300 * time.Millisecond
+			opts := testClientOptions()
+			opts.RetryCount = 1000
+			opts.Jitter = tt.jitter
+			opts.MaxRetryElapsedTime = budget
+
+			fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+			start := time.Now()
+			_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(opts))
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, ErrRetryBudgetExhausted) {
+				t.Errorf("getDeviceData() error = %v, want %v", err, ErrRetryBudgetExhausted)
+			}
+			if !strings.Contains(fmt.Sprint(err), "gave up retrying after the maximum elapsed time: last status 503") {
+				t.Errorf("getDeviceData() error = %v, want it to carry the last status code", err)
+			}
+			// only the last attempt itself may run past the budget
+			if elapsed > budget+100*time.Millisecond {
+				t.Errorf("getDeviceData() gave up after %v, want about %v", elapsed, budget)
+			}
+			if got := atomic.LoadInt32(&requests); got < 2 {
+				t.Errorf("server received %v requests, want the call to be retried", got)
+			}
+		})
+	}
+}
+
+func TestMaxRetryElapsedTimeBelowMinWait(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer s.Close()
+
+	opts := testClientOptions()
+	opts.RetryCount = 5
+	opts.RetryMinWaitTime = 500 * time.Millisecond
+	opts.RetryMaxWaitTime = time.Second
+	opts.MaxRetryElapsedTime = 50 * time.Millisecond
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	start := time.Now()
+	_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(opts))
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Errorf("getDeviceData() error = %v, want %v", err, ErrRetryBudgetExhausted)
+	}
+	if !errors.Is(err, ErrUnexpectedStatus) {
+		t.Errorf("getDeviceData() error = %v, want it to wrap %v", err, ErrUnexpectedStatus)
+	}
+	if elapsed >= opts.RetryMinWaitTime {
+		t.Errorf("getDeviceData() gave up after %v, want it to give up before waiting %v", elapsed,
+			opts.RetryMinWaitTime)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("server received %v requests, want 1", got)
+	}
+}
+
+func TestDisableRetries(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer s.Close()
+
+	opts := testClientOptions()
+	opts.RetryCount = 5
+	opts.DisableRetries = true
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(opts))
+	if !errors.Is(err, ErrUnexpectedStatus) {
+		t.Errorf("getDeviceData() error = %v, want %v", err, ErrUnexpectedStatus)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("server received %v requests, want exactly 1", got)
+	}
+}
+
+func TestRetryOnlyGets(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		method string
+		want   int32
+	}{
+		{http.MethodGet, 3},
+		{http.MethodPost, 1},
+		{http.MethodPut, 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.method, func(t *testing.T) {
+			t.Parallel()
+			var requests int32
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}))
+			t.Cleanup(s.Close)
+
+			opts := testClientOptions()
+			opts.RetryCount = 2
+			client, err := CreateAwnClientWithOptions(s.URL, "/v1", opts)
+			if err != nil {
+				t.Fatalf("CreateAwnClientWithOptions() error = %v", err)
+			}
+
+			_, _ = client.R().Execute(tt.method, "/devices")
+			if got := atomic.LoadInt32(&requests); got != tt.want {
+				t.Errorf("server received %v %v requests, want %v", got, tt.method, tt.want)
+			}
+		})
+	}
+}
+
+// proxyStub is a helper function that starts a plain HTTP proxy stub, which answers
+// every request itself, and returns it along with the requests that it received.
+func proxyStub(t *testing.T) (*httptest.Server, func() []*http.Request) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, r)
+			mu.Unlock()
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	t.Cleanup(s.Close)
+
+	return s, func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestProxy(t *testing.T) {
+	proxy, received := proxyStub(t)
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "secret")
+
+	// the host does not exist, so the call only succeeds through the proxy
+	opts := testClientOptions()
+	opts.Proxy = proxyURL.String()
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, "http://rt.ambientweather.invalid", "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("proxy received %v requests, want 1", len(requests))
+	}
+	if got := requests[0].URL.Host; got != "rt.ambientweather.invalid" {
+		t.Errorf("proxy received a request for %v, want rt.ambientweather.invalid", got)
+	}
+	if got := requests[0].Header.Get("Proxy-Authorization"); !strings.HasPrefix(got, "Basic ") {
+		t.Errorf("Proxy-Authorization = %q, want basic credentials", got)
+	}
+}
+
+// proxyEnvChild is the environment variable that tells TestProxyFromEnv that it runs in
+// the child process.
+const proxyEnvChild = "AWN_TEST_PROXY_ENV_CHILD"
+
+func TestProxyFromEnv(t *testing.T) {
+	// net/http reads the proxy environment variables once per process, so the test runs
+	// itself again in a fresh process where nothing was sent yet
+	if os.Getenv(proxyEnvChild) == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestProxyFromEnv$", "-test.v")
+		cmd.Env = append(os.Environ(), proxyEnvChild+"=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("child process failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	proxy, received := proxyStub(t)
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "http_proxy", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(name, "")
+	}
+	// without a scheme, which net/http takes as http://
+	t.Setenv("HTTP_PROXY", strings.TrimPrefix(proxy.URL, "http://"))
+	t.Setenv("NO_PROXY", "direct.invalid")
+
+	// an explicit proxy without a scheme is rejected, but the environment is not checked
+	if _, err := CreateAwnClient("http://rt.ambientweather.invalid", "/v1"); err != nil {
+		t.Fatalf("CreateAwnClient() error = %v", err)
+	}
+
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+	opts := testClientOptions()
+	opts.DisableRetries = true
+
+	_, err := getDeviceData(context.Background(), fd, "http://rt.ambientweather.invalid", "/v1",
+		WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+	if got := len(received()); got != 1 {
+		t.Errorf("proxy received %v requests, want 1", got)
+	}
+
+	// hosts in NO_PROXY are reached directly, so the call fails to resolve the host
+	_, err = getDeviceData(context.Background(), fd, "http://direct.invalid", "/v1", WithClientOptions(opts))
+	if err == nil {
+		t.Error("getDeviceData() went through the proxy for a host in NO_PROXY")
+	}
+	if got := len(received()); got != 1 {
+		t.Errorf("proxy received %v requests, want 1", got)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"TestDefault", "", defaultUserAgent()},
+		{"TestOverride", "my-station-dashboard/1.2", "my-station-dashboard/1.2"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			proxy, received := proxyStub(t)
+			opts := testClientOptions()
+			opts.UserAgent = tt.userAgent
+			fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+			_, err := getDeviceData(context.Background(), fd, proxy.URL, "/v1", WithClientOptions(opts))
+			if err != nil {
+				t.Fatalf("getDeviceData() error = %v", err)
+			}
+
+			requests := received()
+			if len(requests) != 1 {
+				t.Fatalf("server received %v requests, want 1", len(requests))
+			}
+			if got := requests[0].Header.Get("User-Agent"); got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingTransport is an http.RoundTripper that records every request and answers it
+// with an empty list of records, without going to the network.
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.requests = append(rt.requests, r)
+	rt.mu.Unlock()
+
+	return &http.Response{ //nolint:exhaustruct
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`[]`)),
+		Request:    r,
+	}, nil
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	transport := &recordingTransport{}
+	opts := testClientOptions()
+	opts.Transport = transport
+	opts.Proxy = "http://127.0.0.1:1" // unused with a custom transport
+	fd := FunctionData{API: "api", App: "app", Epoch: 1697142300000, Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, "http://rt.ambientweather.invalid", "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if len(transport.requests) != 1 {
+		t.Fatalf("transport received %v requests, want 1", len(transport.requests))
+	}
+
+	got := transport.requests[0]
+	if got.URL.Host != "rt.ambientweather.invalid" || got.URL.Path != "/v1/devices/00:11:22:33:44:55" {
+		t.Errorf("transport received a request for %v, want rt.ambientweather.invalid/v1/devices/00:11:22:33:44:55",
+			got.URL)
+	}
+	if got.Header.Get("User-Agent") != defaultUserAgent() {
+		t.Errorf("User-Agent = %q, want %q", got.Header.Get("User-Agent"), defaultUserAgent())
+	}
+}
+
+func TestTransportCarriesCredentials(t *testing.T) {
+	t.Parallel()
+	transport := &recordingTransport{}
+	opts := testClientOptions()
+	opts.Transport = transport
+	fd := FunctionData{API: "api", App: "app", Epoch: 1697142300000, Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, "http://rt.ambientweather.invalid", "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+	_, err = GetLatestData(context.Background(), fd, "http://rt.ambientweather.invalid", "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("GetLatestData() error = %v", err)
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if len(transport.requests) != 2 {
+		t.Fatalf("transport received %v requests, want 2", len(transport.requests))
+	}
+
+	// the API only takes the keys as query parameters
+	for _, got := range transport.requests {
+		query := got.URL.Query()
+		if query.Get("apiKey") != "api" || query.Get("applicationKey") != "app" {
+			t.Errorf("request for %v has query %v, want apiKey=api and applicationKey=app", got.URL.Path, query)
+		}
+		if got.Header.Get("apiKey") != "" || got.Header.Get("applicationKey") != "" {
+			t.Errorf("request for %v sent the keys as headers: %v", got.URL.Path, got.Header)
+		}
+	}
+}
+
+func TestDefaultUserAgent(t *testing.T) {
+	t.Parallel()
+	// tests run from a working copy, so the version is unknown
+	if got := defaultUserAgent(); got != "ambient-weather-client/devel" {
+		t.Errorf("defaultUserAgent() = %q, want ambient-weather-client/devel", got)
+	}
+}
+
+func TestInvalidProxy(t *testing.T) {
+	t.Parallel()
+	for _, proxy := range []string{"proxy:3128", "://bad", "/just/a/path"} {
+		opts := ClientOptions{Proxy: proxy}
+		if _, err := CreateAwnClientWithOptions("http://127.0.0.1", "/v1", opts); err == nil {
+			t.Errorf("CreateAwnClientWithOptions() with proxy %q error = %v, want an error", proxy, err)
+		}
+	}
+}
+
+func TestRateLimiterSpacing(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		requests []time.Time
+	)
+	records := pagedHandler(recentRecords(3, time.Hour), false)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, time.Now())
+			mu.Unlock()
+			records(w, r)
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	interval := 100 * time.Millisecond
+	opts := ClientOptions{RateLimiter: rate.NewLimiter(rate.Every(interval), 1)}
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-72 * time.Hour).UnixMilli(),
+	}
+
+	_, err := GetHistoricalData(ctx, fd, s.URL, "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("GetHistoricalData() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) < 3 {
+		t.Fatalf("server received %v requests, want at least 3", len(requests))
+	}
+	for i := 1; i < len(requests); i++ {
+		// allow a little slack for timer granularity
+		if gap := requests[i].Sub(requests[i-1]); gap < interval-10*time.Millisecond {
+			t.Errorf("gap between request %v and %v = %v, want at least %v", i-1, i, gap, interval)
+		}
+	}
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	t.Parallel()
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+
+	first, _ := NewClientWithOptions("http://127.0.0.1", "/v1", ClientOptions{RateLimiter: limiter})
+	second, _ := NewClientWithOptions("http://127.0.0.1", "/v1", ClientOptions{RateLimiter: limiter})
+
+	if !limiter.Allow() {
+		t.Fatalf("limiter should allow the first call")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the shared limiter has been used up, so neither client can make a call in time
+	for _, client := range []*Client{first, second} {
+		_, err := client.R().SetContext(ctx).Get("devices")
+		if err == nil {
+			t.Errorf("Get() error = %v, want a rate limiter error", err)
+		}
+	}
+}
+
+func TestWithChannelBuffer(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		buffer       int
+		wantRequests int32
+	}{
+		// 4 pages in total: the producer fetches buffer pages, plus one that it blocks on
+		{"TestUnbuffered", 0, 1},
+		{"TestPartialBuffer", 2, 3},
+		{"TestNegativeBuffer", -1, 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var requests int32
+			records := pagedHandler(recentRecords(4, time.Hour), false)
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					records(w, r)
+				}))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{
+				API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+				Epoch: time.Now().Add(-72*time.Hour - time.Minute).UnixMilli(),
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+
+			out, err := GetHistoricalDataAsync(ctx, fd, s.URL, "/v1", &wg,
+				WithClientOptions(testClientOptions()), WithChannelBuffer(tt.buffer))
+			if err != nil {
+				t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+			}
+
+			// let the producer run ahead as far as it can before anything is read
+			time.Sleep(200 * time.Millisecond)
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("server received %v requests before any reads, want %v", got, tt.wantRequests)
+			}
+
+			count := 0
+			for range out {
+				count++
+			}
+			if count != 4 {
+				t.Errorf("GetHistoricalDataAsync() sent %v results, want 4", count)
+			}
+		})
+	}
+}
+
+func TestWithChannelBufferDoesNotBlock(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(pagedHandler(recentRecords(4, time.Hour), false))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-72*time.Hour - time.Minute).UnixMilli(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	out, err := GetHistoricalDataAsync(ctx, fd, s.URL, "/v1", &wg,
+		WithClientOptions(testClientOptions()), WithChannelBuffer(4))
+	if err != nil {
+		t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+	}
+
+	// every result fits in the buffer, so the producer finishes without a single read
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("producer blocked even though the buffer had room for every result")
+	}
+
+	if len(out) != 4 {
+		t.Errorf("channel holds %v buffered results, want 4", len(out))
+	}
+}
@@ -1,16 +1,25 @@
 package awn
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
 )
 
 func TestConvertTimeToEpoch(t *testing.T) {
@@ -52,27 +61,137 @@ func TestConvertTimeToEpochBadFormat(t *testing.T) {
 	}
 }
 
+func TestBatchConvertTimeToEpoch(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		dates     []string
+		want      []int64
+		wantIndex int
+	}{
+		{"TestAllValid", []string{"2014-01-01", "2023-11-15"}, []int64{1388534400000, 1700006400000}, -1},
+		{"TestEmpty", []string{}, []int64{}, -1},
+		{"TestMalformedInTheMiddle", []string{"2014-01-01", "11-15-2021", "2023-11-15"}, nil, 1},
+		{"TestImpossibleDate", []string{"2014-01-01", "2023-11-15", "2023-02-30"}, nil, 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := BatchConvertTimeToEpoch(tt.dates)
+			if tt.wantIndex < 0 {
+				if err != nil || !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("BatchConvertTimeToEpoch() = %v, %v, want %v", got, err, tt.want)
+				}
+				return
+			}
+
+			var clientErr ClientError
+			if !errors.Is(err, ErrMalformedDate) || !errors.As(err, &clientErr) || clientErr.value != tt.wantIndex {
+				t.Errorf("BatchConvertTimeToEpoch() error = %v, want %v at index %v", err, ErrMalformedDate, tt.wantIndex)
+			}
+			if got != nil {
+				t.Errorf("BatchConvertTimeToEpoch() = %v, want nil", got)
+			}
+		})
+	}
+}
+
+func TestNormalizeMacAddress(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		mac     string
+		want    string
+		wantErr error
+	}{
+		{"TestColons", "00:11:22:aa:bb:cc", "00:11:22:aa:bb:cc", nil},
+		{"TestDashes", "00-11-22-aa-bb-cc", "00:11:22:aa:bb:cc", nil},
+		{"TestBare", "001122aabbcc", "00:11:22:aa:bb:cc", nil},
+		{"TestUpperCase", "00:11:22:AA:BB:CC", "00:11:22:aa:bb:cc", nil},
+		{"TestEmpty", "", "", ErrMalformedMacAddress},
+		{"TestMixedSeparators", "00:11-22:aa-bb:cc", "", ErrMalformedMacAddress},
+		{"TestNotHex", "00:11:22:aa:bb:zz", "", ErrMalformedMacAddress},
+		{"TestTooShort", "00:11:22:aa:bb", "", ErrMalformedMacAddress},
+		{"TestTooLong", "001122aabbccdd", "", ErrMalformedMacAddress},
+		{"TestSingleDigitOctets", "0:11:22:aa:bb:cc", "", ErrMalformedMacAddress},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := NormalizeMacAddress(tt.mac)
+			if got != tt.want || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("NormalizeMacAddress(%q) = %q, %v, want %q, %v", tt.mac, got, err, tt.want, tt.wantErr)
+			}
+			wantMsg := fmt.Sprintf("mac address is malformed. should be like 00:11:22:33:44:55: length %v", len(tt.mac))
+			if tt.wantErr != nil && err.Error() != wantMsg {
+				t.Errorf("NormalizeMacAddress(%q) error message = %q, want %q", tt.mac, err.Error(), wantMsg)
+			}
+		})
+	}
+}
+
+func TestYearMonthDayVerify(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		y       YearMonthDay
+		want    bool
+		wantErr error
+	}{
+		{"TestValidDate", "2023-01-01", true, nil},
+		{"TestLastDayOfYear", "2023-12-31", true, nil},
+		{"TestLeadingGarbage", "garbage2023-01-01", false, ErrMalformedDate},
+		{"TestTrailingGarbage", "2023-01-01garbage", false, ErrMalformedDate},
+		{"TestEmbeddedDate", "garbage2023-01-01garbage", false, ErrMalformedDate},
+		{"TestDateTime", "2023-01-01T00:00", false, ErrMalformedDate},
+		{"TestMonthZero", "2023-00-10", false, ErrMalformedDate},
+		{"TestMonthThirteen", "2023-13-10", false, ErrMalformedDate},
+		{"TestDayZero", "2023-01-00", false, ErrMalformedDate},
+		{"TestDayThirtyTwo", "2023-01-32", false, ErrMalformedDate},
+		{"TestEmpty", "", false, ErrMalformedDate},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.y.verify()
+			if got != tt.want {
+				t.Errorf("verify() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestCreateApiConfig(t *testing.T) {
 	t.Parallel()
 	_, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
 
-	fd := FunctionData{"api", "app", 0, 1, ""}
+	fd := FunctionData{API: "api", App: "app", Epoch: 0, Limit: 1, Mac: ""}
 
 	type args struct {
-		api string
-		app string
+		api  string
+		app  string
+		more []string
 	}
 	tests := []struct {
 		name string
 		args args
 		want *FunctionData
 	}{
-		{name: "TestCreateApiConfig", args: args{"api", "app"}, want: &fd},
+		{name: "TestCreateApiConfig", args: args{"api", "app", nil}, want: &fd},
+		{name: "TestMultipleAPIKeys", args: args{"api", "app", []string{"api2", "api3"}}, want: &FunctionData{
+			API: "api", APIKeys: []string{"api2", "api3"}, App: "app", Limit: 1,
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := CreateAPIConfig(tt.args.api, tt.args.app)
+			got := CreateAPIConfig(tt.args.api, tt.args.app, tt.args.more...)
 
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("CreateAPIConfig() = %v, want %v", got, tt.want)
@@ -87,11 +206,45 @@ func TestCreateApiConfig(t *testing.T) {
 	}
 }
 
+func TestCreateAPIConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     string
+		app     string
+		want    *FunctionData
+		wantErr error
+	}{
+		{"TestBothSet", "api", "app", &FunctionData{API: "api", App: "app", Limit: 1}, nil},
+		{"TestAPIKeyEmpty", "", "app", nil, ErrAPIKeyMissing},
+		{"TestAppKeyEmpty", "api", "", nil, ErrAppKeyMissing},
+		{"TestBothEmpty", "", "", nil, ErrAPIKeyMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWN_TEST_API_KEY", tt.api)
+			t.Setenv("AWN_TEST_APP_KEY", tt.app)
+
+			got, err := CreateAPIConfigFromEnv("AWN_TEST_API_KEY", "AWN_TEST_APP_KEY")
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("CreateAPIConfigFromEnv() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateAPIConfigFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// unset variables behave like empty ones
+	if _, err := CreateAPIConfigFromEnv("AWN_TEST_UNSET_API_KEY", "AWN_TEST_UNSET_APP_KEY"); !errors.Is(err, ErrAPIKeyMissing) {
+		t.Errorf("CreateAPIConfigFromEnv() error = %v, want %v", err, ErrAPIKeyMissing)
+	}
+}
+
 func TestGetLatestData(t *testing.T) {
 	t.Skip("skipping test -- flaky")
 
 	fd := FunctionData{API: "api_key_goes_here", App: "app_key_goes_here"}
-	jsonData := `{"info": {}, "DeviceData": {}, "macAddress": "00:00:00:00:00:00"}`
+	jsonData := `[{"info": {}, "lastData": {}, "macAddress": "00:00:00:00:00:00"}]`
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -115,7 +268,7 @@ func TestGetLatestData(t *testing.T) {
 			baseURL:  s.URL,
 			ctx:      ctx,
 			version:  "/v1",
-			response: &AmbientDevice{},
+			response: &AmbientDevice{{MacAddress: "00:00:00:00:00:00"}},
 			want:     nil,
 		},
 	}
@@ -136,6 +289,83 @@ func TestGetLatestData(t *testing.T) {
 	}
 }
 
+func TestGetLatestDataMultipleKeys(t *testing.T) {
+	t.Parallel()
+	devicesByKey := map[string]string{
+		"api1": `[{"macAddress":"00:00:00:00:00:01"},{"macAddress":"00:00:00:00:00:02"}]`,
+		"api2": `[{"macAddress":"00:00:00:00:00:02"},{"macAddress":"00:00:00:00:00:03"}]`,
+		"api3": `[]`,
+	}
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := r.URL.Query().Get("apiKey")
+			mu.Lock()
+			keys = append(keys, apiKey)
+			mu.Unlock()
+
+			body, ok := devicesByKey[apiKey]
+			if !ok || r.URL.Query().Get("applicationKey") != "app" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error":"apiKey-missing"}`))
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		fd       *FunctionData
+		wantMacs []string
+		wantKeys []string
+		wantErr  error
+	}{
+		{"TestSingleKey", CreateAPIConfig("api1", "app"),
+			[]string{"00:00:00:00:00:01", "00:00:00:00:00:02"}, []string{"api1"}, nil},
+		{"TestDeduplicatesByMac", CreateAPIConfig("api1", "app", "api2", "api3"),
+			[]string{"00:00:00:00:00:01", "00:00:00:00:00:02", "00:00:00:00:00:03"},
+			[]string{"api1", "api2", "api3"}, nil},
+		{"TestRepeatedKeys", CreateAPIConfig("api2", "app", "api2", "", "api1"),
+			[]string{"00:00:00:00:00:02", "00:00:00:00:00:03", "00:00:00:00:00:01"},
+			[]string{"api2", "api1"}, nil},
+		{"TestOneKeyFails", CreateAPIConfig("api1", "app", "bad"), nil, []string{"api1", "bad"}, ErrAPIKeyMissing},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		keys = nil
+		mu.Unlock()
+
+		got, err := GetLatestData(ctx, *tt.fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: GetLatestData() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(keys, tt.wantKeys) {
+			t.Errorf("%v: server received apiKeys %v, want %v", tt.name, keys, tt.wantKeys)
+		}
+		if tt.wantErr != nil {
+			if got != nil {
+				t.Errorf("%v: GetLatestData() = %v, want nil", tt.name, got)
+			}
+			continue
+		}
+
+		var macs []string
+		for _, device := range *got {
+			macs = append(macs, device.MacAddress)
+		}
+		if !reflect.DeepEqual(macs, tt.wantMacs) {
+			t.Errorf("%v: GetLatestData() MAC addresses = %v, want %v", tt.name, macs, tt.wantMacs)
+		}
+	}
+}
+
 func TestGetEnvVar(t *testing.T) {
 	t.Skip("flaky")
 	t.Parallel()
@@ -210,94 +440,285 @@ func TestGetEnvVars(t *testing.T) {
 	})
 }
 
-//	func TestGetHistoricalData(t *testing.T) {
-//		t.Parallel()
-//		type args struct {
-//			f FunctionData
-//		}
-//		tests := []struct {
-//			name    string
-//			args    args
-//			want    []DeviceDataResponse
-//			wantErr bool
-//		}{
-//			// TODO: Add test cases.
-//		}
-//		for _, tt := range tests {
-//			t.Run(tt.name, func(t *testing.T) {
-//				got, err := GetHistoricalData(tt.args.f)
-//				if (err != nil) != tt.wantErr {
-//					t.Errorf("GetHistoricalData() error = %v, wantErr %v", err, tt.wantErr)
-//					return
-//				}
-//				if !reflect.DeepEqual(got, tt.want) {
-//					t.Errorf("GetHistoricalData() got = %v, want %v", got, tt.want)
-//				}
-//			})
-//		}
-//	}
-//
-//	func TestGetHistoricalDataAsync(t *testing.T) {
-//		t.Parallel()
-//		type args struct {
-//			f FunctionData
-//			w *sync.WaitGroup
-//		}
-//		tests := []struct {
-//			name    string
-//			args    args
-//			want    <-chan DeviceDataResponse
-//			wantErr bool
-//		}{
-//			// TODO: Add test cases.
-//		}
-//		for _, tt := range tests {
-//			t.Run(tt.name, func(t *testing.T) {
-//				got, err := GetHistoricalDataAsync(tt.args.f, tt.args.w)
-//				if (err != nil) != tt.wantErr {
-//					t.Errorf("GetHistoricalDataAsync() error = %v, wantErr %v", err, tt.wantErr)
-//					return
-//				}
-//				if !reflect.DeepEqual(got, tt.want) {
-//					t.Errorf("GetHistoricalDataAsync() got = %v, want %v", got, tt.want)
-//				}
-//			})
-//		}
-//	}
+func TestGetHistoricalData(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 7, 5, 12, 0, 0, 0, time.UTC)
+	records := make([]int64, 5)
+	for i := range records {
+		records[i] = now.Add(-time.Duration(i+1) * time.Hour).UnixMilli()
+	}
+	// a record after the fixed clock, which is never asked for
+	future := now.Add(time.Hour).UnixMilli()
+
+	s := httptest.NewServer(pagedHandler(append([]int64{future}, records...), false))
+	t.Cleanup(s.Close)
+
+	record := func(dateutc int64) WeatherRecord {
+		return WeatherRecord{Dateutc: dateutc, Tempf: 85.8}
+	}
+
+	type args struct {
+		f FunctionData
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []DeviceDataResponse
+		wantErr bool
+	}{
+		{"TestPages", args{FunctionData{Epoch: now.Add(-3 * time.Hour).UnixMilli(), Limit: 2}},
+			[]DeviceDataResponse{{record(records[0]), record(records[1])}, {record(records[2])}}, false},
+		{"TestSinglePage", args{FunctionData{Epoch: now.Add(-2 * time.Hour).UnixMilli(), Limit: 10}},
+			[]DeviceDataResponse{{record(records[0]), record(records[1])}}, false},
+		{"TestEpochIsNow", args{FunctionData{Epoch: now.UnixMilli(), Limit: 10}}, nil, false},
+		{"TestEpochInFuture", args{FunctionData{Epoch: future, Limit: 10}}, nil, false},
+		{"TestInvalidLimit", args{FunctionData{Epoch: now.UnixMilli(), Limit: -1}}, nil, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := tt.args.f
+			fd.API, fd.App, fd.Mac = "api", "app", "00:11:22:33:44:55"
+
+			got, err := GetHistoricalData(ctx, fd, s.URL, "/v1",
+				WithClientOptions(testClientOptions()), WithClock(fixedClock(now)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetHistoricalData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetHistoricalData() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIVersion(t *testing.T) {
+	t.Parallel()
+	if APIVersion != "/v1" {
+		t.Errorf("APIVersion = %v, want /v1", APIVersion)
+	}
+	if got := SupportedAPIVersions(); !reflect.DeepEqual(got, []string{"/v1"}) {
+		t.Errorf("SupportedAPIVersions() = %v, want [/v1]", got)
+	}
+}
 
 func TestCreateAwnClient(t *testing.T) {
 	t.Parallel()
-	header := http.Header{}
-	header.Add("Accept", "application/json")
+	tests := []struct {
+		name    string
+		url     string
+		version string
+		want    ClientConfig
+	}{
+		{name: "TestCreateAwnClient", url: "http://127.0.0.1", version: "/v1", want: ClientConfig{
+			BaseURL:          "http://127.0.0.1/v1",
+			Version:          "/v1",
+			RetryCount:       retryCount,
+			RetryMinWaitTime: retryMinWaitTimeSeconds * time.Second,
+			RetryMaxWaitTime: retryMaxWaitTimeSeconds * time.Second,
+			Timeout:          defaultCtxTimeout * time.Second,
+			Debug:            debugMode,
+			RateLimit:        defaultRequestsPerSecond,
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := CreateAwnClient(tt.url, tt.version)
+			if err != nil {
+				t.Fatalf("CreateAwnClient() error = %v", err)
+			}
+
+			// the resty client does not hand back its rate limiter, so Config reads a
+			// default one instead
+			client := &Client{Client: got, limiter: rate.NewLimiter(defaultRequestsPerSecond, 1), version: tt.version}
+			if config := client.Config(); config != tt.want {
+				t.Errorf("CreateAwnClient() config = %+v, want %+v", config, tt.want)
+			}
+			if accept := got.Header.Get("Accept"); accept != "application/json" {
+				t.Errorf("CreateAwnClient() Accept header = %v, want application/json", accept)
+			}
+		})
+	}
+}
 
+func TestCreateAwnClientInvalidConfig(t *testing.T) {
+	t.Parallel()
 	tests := []struct {
-		name string
-		want *resty.Client
-	}{
-		{name: "TestCreateAwnClient", want: &resty.Client{
-			BaseURL:                "http://127.0.0.1",
-			Header:                 header,
-			RetryCount:             0,
-			RetryWaitTime:          retryMinWaitTimeSeconds * time.Second,
-			RetryMaxWaitTime:       retryMaxWaitTimeSeconds * time.Second,
-			HeaderAuthorizationKey: "Authorization",
+		name    string
+		url     string
+		version string
+		want    error
+		wantMsg string
+	}{
+		{"TestValid", "https://rt.ambientweather.net", "/v1", nil, ""},
+		{"TestEmptyURL", "", "/v1", ErrInvalidClientConfig,
+			"client needs a valid base url and an api version: url is empty"},
+		{"TestMalformedURL", "http://[::1", "/v1", ErrInvalidClientConfig,
+			"client needs a valid base url and an api version: parse "},
+		{"TestMissingScheme", "rt.ambientweather.net", "/v1", ErrInvalidClientConfig,
+			"client needs a valid base url and an api version: url must be scheme://host[:port]: rt.ambientweather.net"},
+		{"TestEmptyVersion", "https://rt.ambientweather.net", "", ErrInvalidClientConfig,
+			"client needs a valid base url and an api version: version is empty"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			client, err := CreateAwnClient(tt.url, tt.version)
+			if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+				t.Fatalf("CreateAwnClient() error = %v, want %v", err, tt.want)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), tt.wantMsg) {
+				t.Errorf("CreateAwnClient() error = %q, want it to start with %q", err, tt.wantMsg)
+			}
+			if (client == nil) != (tt.want != nil) {
+				t.Errorf("CreateAwnClient() client = %v, want a client only without an error", client)
+			}
+		})
+	}
+}
+
+func TestRequestsLandOnBaseURL(t *testing.T) {
+	t.Parallel()
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			paths = append(paths, r.URL.Path)
+			mu.Unlock()
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+	opt := WithClientOptions(testClientOptions())
+
+	if _, err := GetLatestData(ctx, fd, s.URL, "/v2", opt); err != nil {
+		t.Fatalf("GetLatestData() error = %v", err)
+	}
+	if _, err := getDeviceData(ctx, fd, s.URL, "/v2", opt); err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"/v2/devices", "/v2/devices/00:11:22:33:44:55"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("server received paths %v, want %v", paths, want)
+	}
+}
+
+func TestCreateAwnClientWithContext(t *testing.T) {
+	t.Parallel()
+	var method string
+	live := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	defer live.Close()
+
+	// grab a free port, then close the listener so that nothing is listening on it
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"TestLiveServer", live.URL, false},
+		{"TestClosedPort", closedURL, true},
+		{"TestUnresolvableHost", "http://awn.invalid", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client, err := CreateAwnClientWithContext(ctx, tt.url, "/v1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateAwnClientWithContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && client == nil {
+				t.Errorf("CreateAwnClientWithContext() returned a nil client")
+			}
+		})
+	}
+
+	if method != http.MethodHead {
+		t.Errorf("health check method = %v, want %v", method, http.MethodHead)
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		url     string
+		version string
+		want    ClientConfig
+	}{
+		{name: "TestDefaultConfig", url: "http://127.0.0.1", version: "/v1", want: ClientConfig{
+			BaseURL:          "http://127.0.0.1/v1",
+			Version:          "/v1",
+			RetryCount:       retryCount,
+			RetryMinWaitTime: retryMinWaitTimeSeconds * time.Second,
+			RetryMaxWaitTime: retryMaxWaitTimeSeconds * time.Second,
+			Timeout:          defaultCtxTimeout * time.Second,
+			Debug:            debugMode,
+			RateLimit:        defaultRequestsPerSecond,
 		}},
 	}
 	for _, tt := range tests {
+		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			got, _ := CreateAwnClient("http://127.0.0.1", "/")
-			if got.BaseURL != tt.want.BaseURL &&
-				!reflect.DeepEqual(got.Header, tt.want.Header) &&
-				got.RetryCount != tt.want.RetryCount &&
-				got.RetryWaitTime != tt.want.RetryWaitTime &&
-				got.RetryMaxWaitTime != tt.want.RetryMaxWaitTime &&
-				got.HeaderAuthorizationKey != tt.want.HeaderAuthorizationKey {
-				t.Errorf("createAwnClient() got = %v, want %v", got, tt.want)
+			t.Parallel()
+			client, err := NewClient(tt.url, tt.version)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			if got := client.Config(); got != tt.want {
+				t.Errorf("Config() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestClientConfigCompare(t *testing.T) {
+	t.Parallel()
+	first, _ := NewClient("http://127.0.0.1", "/v1")
+	second, _ := NewClient("http://127.0.0.1", "/v1")
+	third, _ := NewClient("http://127.0.0.1", "/v2")
+
+	if first.Config() != second.Config() {
+		t.Errorf("Config() = %+v, want %+v", first.Config(), second.Config())
+	}
+	if first.Config() == third.Config() {
+		t.Errorf("Config() = %+v, should differ from %+v", first.Config(), third.Config())
+	}
+
+	second.SetRetryCount(0)
+	if first.Config() == second.Config() {
+		t.Errorf("Config() = %+v, should reflect the changed retry count", second.Config())
+	}
+}
+
 //func Test_getDeviceData(t *testing.T) {
 //	t.Parallel()
 //	type args struct {
@@ -324,3 +745,1755 @@ func TestCreateAwnClient(t *testing.T) {
 //		})
 //	}
 //}
+
+func TestCheckResponse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		resp   map[string]string
+		wantOk bool
+		want   error
+	}{
+		{"TestNoError", map[string]string{}, true, nil},
+		{"TestAPIKeyMissing", map[string]string{"error": "apiKey-missing"}, false, ErrAPIKeyMissing},
+		{"TestAppKeyMissing", map[string]string{"error": "applicationKey-missing"}, false, ErrAppKeyMissing},
+		{"TestDateInvalid", map[string]string{"error": "date-invalid"}, false, ErrInvalidDateFormat},
+		{"TestMacAddressMissing", map[string]string{"error": "macAddress-missing"}, false, ErrMacAddressMissing},
+		{"TestUnknownError", map[string]string{"error": "something-else"}, false, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ok, err := CheckResponse(tt.resp)
+			if ok != tt.wantOk {
+				t.Errorf("CheckResponse() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+				t.Errorf("CheckResponse() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorEnvelopes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"TestAPIKeyMissing", http.StatusUnauthorized, `{"error":"apiKey-missing"}`, ErrAPIKeyMissing},
+		{"TestAppKeyMissing", http.StatusUnauthorized, `{"error":"applicationKey-missing"}`, ErrAppKeyMissing},
+		{"TestDateInvalid", http.StatusBadRequest, `{"error":"date-invalid","message":"Please use ms"}`, ErrInvalidDateFormat},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(tt.status)
+					_, _ = w.Write([]byte(tt.body))
+				}))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+			data, err := getDeviceData(ctx, fd, s.URL, "/v1")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("getDeviceData() error = %v, want %v", err, tt.want)
+			}
+			if data != nil {
+				t.Errorf("getDeviceData() = %v, want nil", data)
+			}
+
+			device, err := GetLatestData(ctx, fd, s.URL, "/v1")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetLatestData() error = %v, want %v", err, tt.want)
+			}
+			if device != nil {
+				t.Errorf("GetLatestData() = %v, want nil", device)
+			}
+		})
+	}
+}
+
+func TestGetLatestDataObjectResponse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		body     string
+		wantMacs int
+		want     error
+		wantMsg  string
+	}{
+		{"TestArray", `[{"macAddress":"00:11:22:33:44:55"}]`, 1, nil, ""},
+		{"TestEmptyArray", ` [] `, 0, nil, ""},
+		{"TestKnownError", `{"error":"apiKey-missing"}`, 0, ErrAPIKeyMissing, ""},
+		{"TestUnknownError", `{"error":"account-suspended"}`, 0, ErrUnknownAPIError,
+			"does not recognize: account-suspended"},
+		{"TestMessageOnly", ` {"message":"Account disabled"}`, 0, ErrUnknownAPIError,
+			`does not recognize: {"message":"Account disabled"}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// the error envelopes come back with a 200, so only the body gives them away
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					_, _ = w.Write([]byte(tt.body))
+				}))
+			defer s.Close()
+
+			got, err := GetLatestData(context.Background(), FunctionData{API: "api", App: "app"}, s.URL, "/v1",
+				WithClientOptions(testClientOptions()))
+			if (err == nil) != (tt.want == nil) || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Fatalf("GetLatestData() error = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				if !strings.HasSuffix(err.Error(), tt.wantMsg) {
+					t.Errorf("GetLatestData() error = %q, want it to end with %q", err, tt.wantMsg)
+				}
+				return
+			}
+			if len(*got) != tt.wantMacs {
+				t.Errorf("GetLatestData() returned %v devices, want %v", len(*got), tt.wantMacs)
+			}
+		})
+	}
+}
+
+func TestUnexpectedStatus(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"TestBadRequest", http.StatusBadRequest, `{"message":"bad request"}`, ErrUnexpectedStatus.with(400)},
+		{"TestUnauthorized", http.StatusUnauthorized, ``, ErrUnexpectedStatus.with(401)},
+		{"TestForbidden", http.StatusForbidden, `<html>Forbidden</html>`, ErrUnexpectedStatus.with(403)},
+		// a rejection that the API explains keeps its more specific error
+		{"TestExplainedRejection", http.StatusUnauthorized, `{"error":"apiKey-missing"}`, ErrAPIKeyMissing},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(tt.status)
+					_, _ = w.Write([]byte(tt.body))
+				}))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+			opt := WithClientOptions(testClientOptions())
+
+			data, err := getDeviceData(ctx, fd, s.URL, "/v1", opt)
+			if !errors.Is(err, tt.want) || !strings.Contains(err.Error(), tt.want.Error()) {
+				t.Errorf("getDeviceData() error = %v, want %v", err, tt.want)
+			}
+			if data != nil {
+				t.Errorf("getDeviceData() = %v, want nil", data)
+			}
+
+			device, err := GetLatestData(ctx, fd, s.URL, "/v1", opt)
+			if !errors.Is(err, tt.want) || !strings.Contains(err.Error(), tt.want.Error()) {
+				t.Errorf("GetLatestData() error = %v, want %v", err, tt.want)
+			}
+			if device != nil {
+				t.Errorf("GetLatestData() = %v, want nil", device)
+			}
+		})
+	}
+}
+
+func TestGetDeviceDataDevicesResponse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		body    string
+		want    error
+		wantMsg string
+	}{
+		{"TestDevicesList", `[{"macAddress":"00:11:22:33:44:55","info":{"name":"Home"},"lastData":{"tempf":70}}]`,
+			ErrUnexpectedDevicesResponse, "expected weather records, but got a list of devices. is the mac address missing?"},
+		{"TestInfoOnly", `[{"info":{"name":"Home"}}]`, ErrUnexpectedDevicesResponse,
+			"expected weather records, but got a list of devices. is the mac address missing?"},
+		{"TestWeatherRecords", `[{"dateutc":1697142300000,"tempf":85.8}]`, nil, ""},
+		{"TestEmpty", `[]`, nil, ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					_, _ = w.Write([]byte(tt.body))
+				}))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+			data, err := getDeviceData(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+			if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+				t.Errorf("getDeviceData() error = %v, want %v", err, tt.want)
+			}
+			if err != nil && err.Error() != tt.wantMsg {
+				t.Errorf("getDeviceData() error message = %q, want %q", err.Error(), tt.wantMsg)
+			}
+			if tt.want != nil && data != nil {
+				t.Errorf("getDeviceData() = %v, want nil", data)
+			}
+		})
+	}
+}
+
+func TestValidateBeforeCall(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opt := WithClientOptions(testClientOptions())
+
+	_, err := getDeviceData(ctx, FunctionData{API: "api", App: "app", Limit: 1}, s.URL, "/v1", opt)
+	if !errors.Is(err, ErrMacAddressMissing) {
+		t.Errorf("getDeviceData() error = %v, want %v", err, ErrMacAddressMissing)
+	}
+	_, err = GetLatestData(ctx, FunctionData{API: "api"}, s.URL, "/v1", opt)
+	if !errors.Is(err, ErrAppKeyMissing) {
+		t.Errorf("GetLatestData() error = %v, want %v", err, ErrAppKeyMissing)
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Errorf("server received %v requests, want none", got)
+	}
+
+	// the devices endpoint does not need a MAC address
+	if _, err := GetLatestData(ctx, FunctionData{API: "api", App: "app"}, s.URL, "/v1", opt); err != nil {
+		t.Errorf("GetLatestData() error = %v, want nil", err)
+	}
+}
+
+func TestGetDeviceDataGzip(t *testing.T) {
+	t.Parallel()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte(twoRecordPayload))
+	_ = zw.Close()
+
+	for _, gzipped := range []bool{false, true} {
+		var acceptEncoding string
+		s := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				if !gzipped {
+					_, _ = w.Write([]byte(twoRecordPayload))
+					return
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				_, _ = w.Write(compressed.Bytes())
+			}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		fd := FunctionData{API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55"}
+
+		got, err := getDeviceData(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+		cancel()
+		s.Close()
+
+		if err != nil {
+			t.Fatalf("getDeviceData() gzipped = %v, error = %v", gzipped, err)
+		}
+		if acceptEncoding != "gzip" {
+			t.Errorf("Accept-Encoding = %q, want %q", acceptEncoding, "gzip")
+		}
+
+		want, _ := decodeDeviceData([]byte(twoRecordPayload), newFetchOptions(nil))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("getDeviceData() gzipped = %v, got %v, want %v", gzipped, got, want)
+		}
+	}
+}
+
+func TestWithRawBody(t *testing.T) {
+	t.Parallel()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte(twoRecordPayload))
+	_ = zw.Close()
+
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compressed.Bytes())
+		}))
+	defer s.Close()
+
+	var raw [][]byte
+	capture := WithRawBody(func(body []byte) { raw = append(raw, bytes.Clone(body)) })
+	fd := FunctionData{API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55"}
+
+	got, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(testClientOptions()), capture)
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	if len(raw) != 1 || string(raw[0]) != twoRecordPayload {
+		t.Errorf("WithRawBody() captured %q, want the decompressed payload %q", raw, twoRecordPayload)
+	}
+	if len(got) != 2 {
+		t.Errorf("getDeviceData() returned %v records, want 2", len(got))
+	}
+}
+
+func TestGetDeviceDataWithFields(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`[{"dateutc":1697142300000,"tempf":85.8,"humidity":79}]`))
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	got, err := getDeviceData(ctx, fd, s.URL, "/v1", WithFields([]string{"tempf"}))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	want := DeviceDataResponse{{Tempf: 85.8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getDeviceData() = %v, want %v", got, want)
+	}
+}
+
+func TestContextCancelledMidFlight(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	t.Cleanup(s.Close)
+	t.Cleanup(func() { close(release) })
+
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{"TestGetDeviceData", func(ctx context.Context) error {
+			_, err := getDeviceData(ctx, fd, s.URL, "/v1")
+			return err
+		}},
+		{"TestGetLatestData", func(ctx context.Context) error {
+			_, err := GetLatestData(ctx, fd, s.URL, "/v1")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			start := time.Now()
+			err := tt.call(ctx)
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, ErrContextTimeoutExceeded) {
+				t.Errorf("error = %v, want %v", err, ErrContextTimeoutExceeded)
+			}
+			if elapsed > 2*time.Second {
+				t.Errorf("call took %v, want it to return promptly after cancellation", elapsed)
+			}
+		})
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	t.Parallel()
+	refused := errors.New("dial tcp 127.0.0.1:1: connect: connection refused")
+
+	tests := []struct {
+		name        string
+		err         error
+		wantTimeout bool
+	}{
+		{"TestDeadlineExceeded", fmt.Errorf("get: %w", context.DeadlineExceeded), true},
+		{"TestCanceled", fmt.Errorf("get: %w", context.Canceled), true},
+		{"TestTransportError", refused, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := requestError(tt.err)
+			if errors.Is(got, ErrContextTimeoutExceeded) != tt.wantTimeout {
+				t.Errorf("requestError() = %v, want timeout %v", got, tt.wantTimeout)
+			}
+			if !tt.wantTimeout && !errors.Is(got, tt.err) {
+				t.Errorf("requestError() = %v, want it to wrap %v", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestContextError(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limiterErr := errors.New("rate: Wait(n=1) would exceed context deadline")
+
+	got := contextError(ctx, limiterErr)
+	if !errors.Is(got, ErrContextTimeoutExceeded) {
+		t.Fatalf("contextError() = %v, want %v", got, ErrContextTimeoutExceeded)
+	}
+	if !errors.Is(got, limiterErr) {
+		t.Errorf("contextError() = %v, want it to wrap %v", got, limiterErr)
+	}
+	if want := "context timeout exceeded: " + limiterErr.Error(); got.Error() != want {
+		t.Errorf("contextError() = %q, want %q", got, want)
+	}
+
+	if got := contextError(context.Background(), limiterErr); got != nil {
+		t.Errorf("contextError() = %v, want nil while the context is still running", got)
+	}
+}
+
+func TestServerErrorVersusTimeout(t *testing.T) {
+	t.Parallel()
+	failing := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`Internal Server Error`))
+		}))
+	defer failing.Close()
+
+	slow := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	defer slow.Close()
+
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+	opts := testClientOptions()
+	opts.RetryCount = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := getDeviceData(ctx, fd, failing.URL, "/v1", WithClientOptions(opts))
+	if err == nil || errors.Is(err, ErrContextTimeoutExceeded) {
+		t.Errorf("getDeviceData() error = %v, want a non-timeout error for a 500", err)
+	}
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+
+	_, err = getDeviceData(shortCtx, fd, slow.URL, "/v1", WithClientOptions(opts))
+	if !errors.Is(err, ErrContextTimeoutExceeded) {
+		t.Errorf("getDeviceData() error = %v, want %v", err, ErrContextTimeoutExceeded)
+	}
+}
+
+// pagedHandler is a test helper that serves records (dateutc values, newest first) the
+// way the devices/macAddress endpoint does: up to limit records before endDate. When
+// inclusive is true, a record at exactly endDate is served as well, so pages overlap.
+func pagedHandler(records []int64, inclusive bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endDate, _ := strconv.ParseInt(r.URL.Query().Get("endDate"), 10, 64)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		page := make([]string, 0, limit)
+		for _, dateutc := range records {
+			if len(page) == limit {
+				break
+			}
+			if dateutc < endDate || (inclusive && dateutc == endDate) {
+				page = append(page, fmt.Sprintf(`{"dateutc":%d,"tempf":85.8}`, dateutc))
+			}
+		}
+
+		_, _ = w.Write([]byte("[" + strings.Join(page, ",") + "]"))
+	}
+}
+
+// fixedClock is a Clock that always returns the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// recentRecords is a test helper that returns n dateutc values, newest first, spaced
+// every interval before now.
+func recentRecords(n int, interval time.Duration) []int64 {
+	now := time.Now()
+	records := make([]int64, n)
+	for i := range records {
+		records[i] = now.Add(-time.Duration(i+1) * interval).UnixMilli()
+	}
+
+	return records
+}
+
+func TestGetHistoricalDataAsyncError(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	records := pagedHandler(recentRecords(3, time.Hour), false)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"date-invalid"}`))
+				return
+			}
+			records(w, r)
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-72 * time.Hour).UnixMilli(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	out, err := GetHistoricalDataAsync(ctx, fd, s.URL, "/v1", &wg, WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+	}
+
+	var results []DeviceDataResult
+	for result := range out {
+		results = append(results, result)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("GetHistoricalDataAsync() sent %v results, want 2", len(results))
+	}
+	if results[0].Err != nil || len(results[0].Data) != 1 {
+		t.Errorf("GetHistoricalDataAsync() first result = %+v, want one record and no error", results[0])
+	}
+	if !errors.Is(results[1].Err, ErrInvalidDateFormat) {
+		t.Errorf("GetHistoricalDataAsync() second result error = %v, want %v", results[1].Err, ErrInvalidDateFormat)
+	}
+}
+
+func TestGetHistoricalDataAsync(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(pagedHandler(recentRecords(3, time.Hour), false))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-48*time.Hour - time.Minute).UnixMilli(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	out, err := GetHistoricalDataAsync(ctx, fd, s.URL, "/v1", &wg, WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+	}
+
+	count := 0
+	for result := range out {
+		if result.Err != nil {
+			t.Errorf("GetHistoricalDataAsync() result error = %v", result.Err)
+		}
+		count++
+	}
+
+	if count != 3 {
+		t.Errorf("GetHistoricalDataAsync() sent %v results, want 3", count)
+	}
+}
+
+func TestGetHistoricalDataAsyncConcurrency(t *testing.T) {
+	t.Parallel()
+	// six days with a record every 6 hours
+	now := time.Date(2023, 10, 13, 0, 0, 0, 0, time.UTC)
+	var records []int64
+	for hour := 6; hour <= 6*24; hour += 6 {
+		records = append(records, now.Add(-time.Duration(hour)*time.Hour).UnixMilli())
+	}
+
+	const workers = 3
+	var inFlight, maxInFlight int32
+	pages := pagedHandler(records, false)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for m := atomic.LoadInt32(&maxInFlight); n > m; m = atomic.LoadInt32(&maxInFlight) {
+				if atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+
+			// the newer the day, the slower the call, so later days are done first
+			endDate, _ := strconv.ParseInt(r.URL.Query().Get("endDate"), 10, 64)
+			time.Sleep(time.Duration(endDate-records[len(records)-1]) / time.Duration(epochIncrement24h) * 10 *
+				time.Millisecond)
+			pages(w, r)
+		}))
+	t.Cleanup(s.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 4, Mac: "00:11:22:33:44:55",
+		Epoch: now.Add(-6 * 24 * time.Hour).UnixMilli(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	out, err := GetHistoricalDataAsync(ctx, fd, s.URL, "/v1", &wg, WithClientOptions(testClientOptions()),
+		WithClock(fixedClock(now)), WithConcurrency(workers))
+	if err != nil {
+		t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+	}
+
+	var got []int64
+	for result := range out {
+		if result.Err != nil {
+			t.Fatalf("GetHistoricalDataAsync() result error = %v", result.Err)
+		}
+		for _, record := range result.Data {
+			got = append(got, record.Dateutc)
+		}
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("GetHistoricalDataAsync() = %v, want %v", got, records)
+	}
+	if n := atomic.LoadInt32(&maxInFlight); n < 2 || n > workers {
+		t.Errorf("GetHistoricalDataAsync() made %v calls at once, want 2 to %v", n, workers)
+	}
+}
+
+func TestGetHistoricalDataAsyncAbandoned(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 10, 13, 0, 0, 0, 0, time.UTC)
+	var records []int64
+	for hour := 6; hour <= 6*24; hour += 6 {
+		records = append(records, now.Add(-time.Duration(hour)*time.Hour).UnixMilli())
+	}
+	s := httptest.NewServer(pagedHandler(records, false))
+	t.Cleanup(s.Close)
+
+	tests := []struct {
+		name        string
+		concurrency int
+	}{
+		{"TestSequential", 1},
+		{"TestConcurrent", 3},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			fd := FunctionData{
+				API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+				Epoch: now.Add(-6 * 24 * time.Hour).UnixMilli(),
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+
+			out, err := GetHistoricalDataAsync(ctx, fd, s.URL, "/v1", &wg, WithClientOptions(testClientOptions()),
+				WithClock(fixedClock(now)), WithConcurrency(tt.concurrency))
+			if err != nil {
+				t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+			}
+
+			// read a single page, then cancel and walk away from the channel
+			<-out
+			cancel()
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("GetHistoricalDataAsync() never finished after the caller stopped reading")
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataAsyncConcurrencyError(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 10, 13, 0, 0, 0, 0, time.UTC)
+	var records []int64
+	for hour := 6; hour <= 6*24; hour += 6 {
+		records = append(records, now.Add(-time.Duration(hour)*time.Hour).UnixMilli())
+	}
+	failedDay := now.Add(-48 * time.Hour).UnixMilli() // the end of the third day back
+
+	pages := pagedHandler(records, false)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			endDate, _ := strconv.ParseInt(r.URL.Query().Get("endDate"), 10, 64)
+			if endDate <= failedDay && endDate > failedDay-epochIncrement24h {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"date-invalid"}`))
+				return
+			}
+			pages(w, r)
+		}))
+	t.Cleanup(s.Close)
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 4, Mac: "00:11:22:33:44:55",
+		Epoch: now.Add(-6 * 24 * time.Hour).UnixMilli(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	out, err := GetHistoricalDataAsync(context.Background(), fd, s.URL, "/v1", &wg,
+		WithClientOptions(testClientOptions()), WithClock(fixedClock(now)), WithConcurrency(3))
+	if err != nil {
+		t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+	}
+
+	var results []DeviceDataResult
+	for result := range out {
+		results = append(results, result)
+	}
+	wg.Wait()
+
+	// the two newer days, then the error, and nothing after it
+	if len(results) != 3 || results[0].Err != nil || results[1].Err != nil ||
+		!errors.Is(results[2].Err, ErrInvalidDateFormat) {
+		t.Errorf("GetHistoricalDataAsync() results = %+v, want two days and then %v", results, ErrInvalidDateFormat)
+	}
+}
+
+func TestDayWindows(t *testing.T) {
+	t.Parallel()
+	day := epochIncrement24h
+	tests := []struct {
+		name  string
+		start int64
+		end   int64
+		want  []dayWindow
+	}{
+		{"TestWholeDays", 10 * day, 12 * day, []dayWindow{{11 * day, 12 * day}, {10 * day, 11 * day}}},
+		{"TestPartialDays", 10*day + 5, 12*day + 7, []dayWindow{
+			{12 * day, 12*day + 7}, {11 * day, 12 * day}, {10*day + 5, 11 * day},
+		}},
+		{"TestWithinADay", 10*day + 5, 10*day + 7, []dayWindow{{10*day + 5, 10*day + 7}}},
+		{"TestEmpty", 10 * day, 10 * day, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := dayWindows(tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dayWindows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataAsyncWaitGroup(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(pagedHandler(recentRecords(4, time.Hour), false))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-72*time.Hour - time.Minute).UnixMilli(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	out, err := GetHistoricalDataAsync(ctx, fd, s.URL, "/v1", &wg, WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("GetHistoricalDataAsync() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	const want = 4
+	for i := 0; i < want; i++ {
+		// give an early Done() the chance to show up before the record is read
+		time.Sleep(20 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatalf("WaitGroup released after %v of %v records", i, want)
+		default:
+		}
+
+		if result := <-out; result.Err != nil {
+			t.Fatalf("GetHistoricalDataAsync() result error = %v", result.Err)
+		}
+	}
+
+	if _, ok := <-out; ok {
+		t.Errorf("GetHistoricalDataAsync() sent more than %v results", want)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("WaitGroup was not released after the channel was closed")
+	}
+}
+
+func TestGetHistoricalDataRetryNoDuplicates(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	records := pagedHandler(recentRecords(9, time.Hour), true)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the second page fails once and is retried
+			if atomic.AddInt32(&calls, 1) == 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			records(w, r)
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 3, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-24 * time.Hour).UnixMilli(),
+	}
+
+	got, err := GetHistoricalData(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("GetHistoricalData() error = %v", err)
+	}
+
+	seen := make(map[int64]bool)
+	for _, page := range got {
+		for _, record := range page {
+			if seen[record.Dateutc] {
+				t.Errorf("GetHistoricalData() returned dateutc %v more than once", record.Dateutc)
+			}
+			seen[record.Dateutc] = true
+		}
+	}
+
+	if len(seen) != 9 {
+		t.Errorf("GetHistoricalData() returned %v distinct records, want 9", len(seen))
+	}
+}
+
+func TestGetHistoricalDataBoundaryDuplicates(t *testing.T) {
+	t.Parallel()
+	// records every 6 hours, including midnight, served with the record at endDate, so
+	// each page starts with the last record of the page before it
+	now := time.Date(2023, 10, 13, 12, 0, 0, 0, time.UTC)
+	var dates []int64
+	for i := 1; i <= 6; i++ {
+		dates = append(dates, now.Add(-time.Duration(i*6)*time.Hour).UnixMilli())
+	}
+	s := httptest.NewServer(pagedHandler(dates, true))
+	t.Cleanup(s.Close)
+
+	tests := []struct {
+		name string
+		opts []Option
+		want int
+	}{
+		{"TestDeduplicated", nil, 6},
+		{"TestRawPages", []Option{WithRawPages()}, 11},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fd := FunctionData{API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55", Epoch: dates[5]}
+			opts := append([]Option{WithClientOptions(testClientOptions()), WithClock(fixedClock(now))}, tt.opts...)
+
+			got, err := GetHistoricalData(context.Background(), fd, s.URL, "/v1", opts...)
+			if err != nil {
+				t.Fatalf("GetHistoricalData() error = %v", err)
+			}
+
+			records := Flatten(got)
+			if len(records) != tt.want {
+				t.Fatalf("GetHistoricalData() returned %v records, want %v", len(records), tt.want)
+			}
+			if tt.opts != nil {
+				return
+			}
+			for i, record := range records {
+				if record.Dateutc != dates[i] {
+					t.Errorf("GetHistoricalData() record %v dateutc = %v, want %v", i, record.Dateutc, dates[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataCancelledKeepsPages(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var calls int32
+	records := pagedHandler(recentRecords(3, time.Hour), false)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the second page hangs until the caller gives up
+			if atomic.AddInt32(&calls, 1) == 2 {
+				cancel()
+				<-r.Context().Done()
+				return
+			}
+			records(w, r)
+		}))
+	t.Cleanup(s.Close)
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-72 * time.Hour).UnixMilli(),
+	}
+
+	got, err := GetHistoricalData(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+	if !errors.Is(err, ErrContextTimeoutExceeded) {
+		t.Errorf("GetHistoricalData() error = %v, want %v", err, ErrContextTimeoutExceeded)
+	}
+	if len(got) != 1 || len(got[0]) != 1 {
+		t.Errorf("GetHistoricalData() = %v, want the first page", got)
+	}
+}
+
+func TestGetHistoricalDataContinueOnError(t *testing.T) {
+	t.Parallel()
+	// three days with a record every 6 hours, so each page of 4 is one day
+	now := time.Date(2023, 10, 13, 0, 0, 0, 0, time.UTC)
+	var records []int64
+	for hour := 6; hour <= 3*24; hour += 6 {
+		records = append(records, now.Add(-time.Duration(hour)*time.Hour).UnixMilli())
+	}
+	middleDay := now.Add(-24 * time.Hour).UnixMilli() // the end of the day that fails
+
+	pages := pagedHandler(records, false)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			endDate, _ := strconv.ParseInt(r.URL.Query().Get("endDate"), 10, 64)
+			// any call for records of the middle day fails
+			if endDate <= middleDay && endDate > middleDay-epochIncrement24h {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"date-invalid"}`))
+				return
+			}
+			pages(w, r)
+		}))
+	t.Cleanup(s.Close)
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 4, Mac: "00:11:22:33:44:55",
+		Epoch: now.Add(-72 * time.Hour).UnixMilli(),
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantPages int
+	}{
+		{"TestFailFast", nil, 0},
+		{"TestContinueOnError", []Option{WithContinueOnError()}, 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			opts := append([]Option{WithClientOptions(testClientOptions()), WithClock(fixedClock(now))}, tt.opts...)
+
+			got, err := GetHistoricalData(context.Background(), fd, s.URL, "/v1", opts...)
+			if !errors.Is(err, ErrInvalidDateFormat) {
+				t.Errorf("GetHistoricalData() error = %v, want %v", err, ErrInvalidDateFormat)
+			}
+			if len(got) != tt.wantPages {
+				t.Fatalf("GetHistoricalData() returned %v pages, want %v", len(got), tt.wantPages)
+			}
+
+			// the newest and the oldest day survive the failure of the one in between
+			for i, page := range got {
+				for _, record := range page {
+					if record.Dateutc < middleDay && record.Dateutc >= middleDay-epochIncrement24h {
+						t.Errorf("GetHistoricalData() page %v has %v from the failed day", i, record.Dateutc)
+					}
+				}
+				if len(page) != 4 {
+					t.Errorf("GetHistoricalData() page %v has %v records, want 4", i, len(page))
+				}
+			}
+		})
+	}
+}
+
+func TestGetDataSince(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 10, 13, 12, 0, 0, 0, time.UTC)
+	records := make([]int64, 6)
+	for i := range records {
+		records[i] = now.Add(-time.Duration(i+1) * time.Hour).UnixMilli()
+	}
+
+	tests := []struct {
+		name      string
+		since     time.Time
+		inclusive bool
+		want      []int64
+	}{
+		{"TestSinceARecord", time.UnixMilli(records[3]), false, []int64{records[2], records[1], records[0]}},
+		{"TestSinceARecordInclusive", time.UnixMilli(records[3]), true, []int64{records[2], records[1], records[0]}},
+		{"TestSinceBetweenRecords", time.UnixMilli(records[2]).Add(-time.Minute), false,
+			[]int64{records[2], records[1], records[0]}},
+		{"TestSinceTheNewest", time.UnixMilli(records[0]), true, nil},
+		{"TestSinceBeforeEverything", now.Add(-24 * time.Hour), false, []int64{
+			records[5], records[4], records[3], records[2], records[1], records[0],
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := httptest.NewServer(pagedHandler(records, tt.inclusive))
+			t.Cleanup(s.Close)
+
+			fd := FunctionData{API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55"}
+
+			got, err := GetDataSince(context.Background(), fd, s.URL, "/v1", tt.since,
+				WithClientOptions(testClientOptions()), WithClock(fixedClock(now)))
+			if err != nil {
+				t.Fatalf("GetDataSince() error = %v", err)
+			}
+
+			var dates []int64
+			for _, record := range got {
+				dates = append(dates, record.Dateutc)
+			}
+			if !reflect.DeepEqual(dates, tt.want) {
+				t.Errorf("GetDataSince() = %v, want %v", dates, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataPaging(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		records   []int64
+		limit     int
+		since     time.Duration
+		inclusive bool
+		want      int
+	}{
+		// a station that uploads every minute produces far more than limit records a day
+		{"TestEveryMinute", recentRecords(1440, time.Minute), 288, 24*time.Hour + time.Minute, false, 1440},
+		{"TestOverlappingPages", recentRecords(1440, time.Minute), 288, 24*time.Hour + time.Minute, true, 1440},
+		{"TestStopsAtEpoch", recentRecords(48, time.Hour), 5, 12*time.Hour + time.Minute, false, 12},
+		{"TestRunsOutOfRecords", recentRecords(7, time.Hour), 5, 72 * time.Hour, false, 7},
+		{"TestOneRecordPerPage", recentRecords(5, time.Hour), 1, 72 * time.Hour, true, 5},
+		{"TestNoRecords", nil, 5, 72 * time.Hour, false, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := httptest.NewServer(pagedHandler(tt.records, tt.inclusive))
+			t.Cleanup(s.Close)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{
+				API: "api", App: "app", Limit: tt.limit, Mac: "00:11:22:33:44:55",
+				Epoch: time.Now().Add(-tt.since).UnixMilli(),
+			}
+
+			got, err := GetHistoricalData(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+			if err != nil {
+				t.Fatalf("GetHistoricalData() error = %v", err)
+			}
+
+			var previous int64
+			count := 0
+			for _, page := range got {
+				for _, record := range page {
+					if previous != 0 && record.Dateutc >= previous {
+						t.Fatalf("GetHistoricalData() record %v is not older than %v", record.Dateutc, previous)
+					}
+					if record.Dateutc < fd.Epoch {
+						t.Errorf("GetHistoricalData() record %v is older than the epoch %v", record.Dateutc, fd.Epoch)
+					}
+					previous = record.Dateutc
+					count++
+				}
+			}
+
+			if count != tt.want {
+				t.Errorf("GetHistoricalData() returned %v records, want %v", count, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataNewestFirst(t *testing.T) {
+	t.Parallel()
+	records := recentRecords(5, time.Hour)
+	s := httptest.NewServer(pagedHandler(records, false))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the start epoch falls exactly on a record, which is included
+	fd := FunctionData{API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55", Epoch: records[3]}
+
+	got, err := GetHistoricalData(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("GetHistoricalData() error = %v", err)
+	}
+
+	var dates []int64
+	for _, record := range Flatten(got) {
+		dates = append(dates, record.Dateutc)
+	}
+	if want := records[:4]; !reflect.DeepEqual(dates, want) {
+		t.Errorf("GetHistoricalData() dates = %v, want %v, newest first", dates, want)
+	}
+}
+
+func TestFetchDeviceDataRequest(t *testing.T) {
+	t.Parallel()
+	var got *http.Request
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	defer s.Close()
+
+	fd := FunctionData{API: "api", App: "app", Epoch: 1697142300000, Limit: 288, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	if got.URL.Path != "/v1/devices/00:11:22:33:44:55" {
+		t.Errorf("getDeviceData() path = %v, want /v1/devices/00:11:22:33:44:55", got.URL.Path)
+	}
+
+	want := map[string]string{"apiKey": "api", "applicationKey": "app", "endDate": "1697142300000", "limit": "288"}
+	for key, value := range want {
+		if v := got.URL.Query().Get(key); v != value {
+			t.Errorf("getDeviceData() query %v = %q, want %q", key, v, value)
+		}
+	}
+}
+
+func TestGetDeviceDataNormalizesMac(t *testing.T) {
+	t.Parallel()
+	paths := make(chan string, 1)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.Path
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	t.Cleanup(s.Close)
+
+	for _, mac := range []string{"00:11:22:AA:BB:CC", "00-11-22-aa-bb-cc", "001122AABBCC"} {
+		fd := FunctionData{API: "api", App: "app", Epoch: 1697142300000, Limit: 1, Mac: mac}
+
+		_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+		if err != nil {
+			t.Fatalf("getDeviceData(%q) error = %v", mac, err)
+		}
+
+		if got := <-paths; got != "/v1/devices/00:11:22:aa:bb:cc" {
+			t.Errorf("getDeviceData(%q) path = %v, want /v1/devices/00:11:22:aa:bb:cc", mac, got)
+		}
+	}
+
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22"}
+	if _, err := getDeviceData(context.Background(), fd, s.URL, "/v1"); !errors.Is(err, ErrMalformedMacAddress) {
+		t.Errorf("getDeviceData() error = %v, want %v", err, ErrMalformedMacAddress)
+	}
+}
+
+func TestPartialResponse(t *testing.T) {
+	t.Parallel()
+	body := `[{"dateutc":1697142300000,"tempf":85.8},{"dateutc":1697142000000,"tem`
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}))
+	t.Cleanup(s.Close)
+
+	tests := []struct {
+		name string
+		opts []Option
+		want error
+	}{
+		{"TestDefaultDecoder", nil, nil},
+		{"TestWithFields", []Option{WithFields([]string{"tempf"})}, nil},
+		{"TestStreamingDecoder", []Option{WithDecoder(func(data []byte, v any) error {
+			return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+		})}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fd := FunctionData{API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55"}
+			opts := append([]Option{WithClientOptions(testClientOptions())}, tt.opts...)
+
+			_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", opts...)
+			if !errors.Is(err, ErrPartialResponse) {
+				t.Errorf("getDeviceData() error = %v, want %v", err, ErrPartialResponse)
+			}
+			wantMsg := fmt.Sprintf("response was cut off or is not valid json: decoding failed at byte %v", len(body))
+			if !strings.HasSuffix(fmt.Sprint(err), wantMsg) {
+				t.Errorf("getDeviceData() error = %v, want it to end with %q", err, wantMsg)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("getDeviceData() error = %v, want it to wrap %v", err, tt.want)
+			}
+		})
+	}
+
+	// errors that are not about the body are left alone
+	if err := partialResponse(nil, ErrUnknownField); !errors.Is(err, ErrUnknownField) || errors.Is(err, ErrPartialResponse) {
+		t.Errorf("partialResponse() = %v, want %v", err, ErrUnknownField)
+	}
+}
+
+func TestGetLatestDataRequest(t *testing.T) {
+	t.Parallel()
+	var got *http.Request
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	defer s.Close()
+
+	fd := FunctionData{API: "api", App: "app"}
+
+	_, err := GetLatestData(context.Background(), fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("GetLatestData() error = %v", err)
+	}
+
+	if got.URL.Path != "/v1/devices" {
+		t.Errorf("GetLatestData() path = %v, want /v1/devices", got.URL.Path)
+	}
+
+	want := map[string]string{"apiKey": "api", "applicationKey": "app"}
+	for key, value := range want {
+		if v := got.URL.Query().Get(key); v != value {
+			t.Errorf("GetLatestData() query %v = %q, want %q", key, v, value)
+		}
+	}
+}
+
+func TestWithNoDataError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		records     []int64
+		noDataError bool
+		wantPages   int
+		want        error
+		wantMsg     string
+	}{
+		{"TestEmptyDefault", nil, false, 0, nil, ""},
+		{"TestEmptyWithOption", nil, true, 0, ErrNoDataForRange,
+			"unable to get device data: no data was found in the requested range"},
+		{"TestOnlyOlderRecordsWithOption", []int64{time.Now().Add(-96 * time.Hour).UnixMilli()}, true, 0,
+			ErrNoDataForRange, "unable to get device data: no data was found in the requested range"},
+		{"TestDataWithOption", recentRecords(3, time.Hour), true, 1, nil, ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := httptest.NewServer(pagedHandler(tt.records, false))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{
+				API: "api", App: "app", Limit: 10, Mac: "00:11:22:33:44:55",
+				Epoch: time.Now().Add(-72 * time.Hour).UnixMilli(),
+			}
+			opts := []Option{WithClientOptions(testClientOptions())}
+			if tt.noDataError {
+				opts = append(opts, WithNoDataError())
+			}
+
+			got, err := GetHistoricalData(ctx, fd, s.URL, "/v1", opts...)
+			if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+				t.Errorf("GetHistoricalData() error = %v, want %v", err, tt.want)
+			}
+			if err != nil && err.Error() != tt.wantMsg {
+				t.Errorf("GetHistoricalData() error message = %q, want %q", err.Error(), tt.wantMsg)
+			}
+			if len(got) != tt.wantPages {
+				t.Errorf("GetHistoricalData() returned %v pages, want %v", len(got), tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataForDevices(t *testing.T) {
+	t.Parallel()
+	handlers := map[string]http.HandlerFunc{
+		"00:00:00:00:00:01": pagedHandler(recentRecords(3, time.Hour), false),
+		"00:00:00:00:00:02": pagedHandler(recentRecords(5, 2*time.Hour), false),
+		"00:00:00:00:00:03": pagedHandler(nil, false),
+		"00:00:00:00:00:04": func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"date-invalid"}`))
+		},
+	}
+	var inFlight, maxInFlight int32
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				seen := atomic.LoadInt32(&maxInFlight)
+				if n <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			mac := strings.TrimPrefix(r.URL.Path, "/v1/devices/")
+			handlers[mac](w, r)
+		}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 2,
+		Epoch: time.Now().Add(-72 * time.Hour).UnixMilli(),
+	}
+	macs := []string{"00:00:00:00:00:01", "00:00:00:00:00:02", "00:00:00:00:00:03", "00:00:00:00:00:04"}
+
+	got, err := GetHistoricalDataForDevices(ctx, fd, s.URL, "/v1", macs, 2, WithClientOptions(testClientOptions()))
+	if !errors.Is(err, ErrInvalidDateFormat) || !strings.Contains(err.Error(), "00:00:00:00:00:04") {
+		t.Errorf("GetHistoricalDataForDevices() error = %v, want %v for the fourth device", err, ErrInvalidDateFormat)
+	}
+
+	want := map[string]int{"00:00:00:00:00:01": 3, "00:00:00:00:00:02": 5, "00:00:00:00:00:03": 0}
+	if len(got) != len(want) {
+		t.Errorf("GetHistoricalDataForDevices() returned %v devices, want %v", len(got), len(want))
+	}
+	for mac, count := range want {
+		records, ok := got[mac]
+		if !ok || len(records) != count {
+			t.Errorf("GetHistoricalDataForDevices()[%v] has %v records, want %v", mac, len(records), count)
+		}
+	}
+	if maxInFlight > 2 {
+		t.Errorf("server had %v requests in flight, want at most 2", maxInFlight)
+	}
+}
+
+func TestEstimateHistoricalCalls(t *testing.T) {
+	t.Parallel()
+	end := time.Date(2023, 10, 13, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		start time.Time
+		limit int
+		want  int
+	}{
+		{"TestThreeDaysFullPages", end.AddDate(0, 0, -3), 288, 4},
+		{"TestThreeDaysSmallPages", end.AddDate(0, 0, -3), 100, 9},
+		{"TestPartialDay", end.Add(-90 * time.Minute), 288, 1},
+		{"TestSixMonths", end.AddDate(0, -6, 0), 288, 184},
+		{"TestLimitAboveMax", end.AddDate(0, -6, 0), 1000, 184},
+		{"TestInvalidLimit", end.AddDate(0, 0, -3), 0, 0},
+		{"TestStartInFuture", end.Add(time.Hour), 288, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := estimateHistoricalCalls(tt.start, end, tt.limit); got != tt.want {
+				t.Errorf("estimateHistoricalCalls() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := EstimateHistoricalCalls(time.Now().AddDate(0, 0, -1), 288); got != 2 {
+		t.Errorf("EstimateHistoricalCalls() = %v, want 2", got)
+	}
+}
+
+func TestGetHistoricalDataProjected(t *testing.T) {
+	t.Parallel()
+	dates := recentRecords(3, time.Hour)
+	s := httptest.NewServer(pagedHandler(dates, false))
+	t.Cleanup(s.Close)
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   []map[string]any
+		err    error
+	}{
+		// co2 is not reported by the mock, so it is left out
+		{"TestSelectedFields", []string{"dateutc", "tempf", "co2"}, []map[string]any{
+			{"dateutc": dates[0], "tempf": 85.8},
+			{"dateutc": dates[1], "tempf": 85.8},
+			{"dateutc": dates[2], "tempf": 85.8},
+		}, nil},
+		{"TestUnknownField", []string{"tempf", "tempc"}, nil, ErrUnknownField},
+		{"TestNoFields", nil, nil, ErrUnknownField},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fd := FunctionData{
+				API: "api", App: "app", Limit: 288, Mac: "00:11:22:33:44:55",
+				Epoch: time.Now().Add(-24 * time.Hour).UnixMilli(),
+			}
+
+			got, err := GetHistoricalDataProjected(context.Background(), fd, s.URL, "/v1", tt.fields,
+				WithClientOptions(testClientOptions()))
+			if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+				t.Fatalf("GetHistoricalDataProjected() error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetHistoricalDataProjected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataBetween(t *testing.T) {
+	t.Parallel()
+	// hourly records from 2023-06-29 through 2023-07-05, newest first
+	last := time.Date(2023, 7, 5, 23, 0, 0, 0, time.UTC)
+	records := make([]int64, 7*24)
+	for i := range records {
+		records[i] = last.Add(-time.Duration(i) * time.Hour).UnixMilli()
+	}
+
+	s := httptest.NewServer(pagedHandler(records, false))
+	t.Cleanup(s.Close)
+
+	tests := []struct {
+		name  string
+		start YearMonthDay
+		end   YearMonthDay
+		want  int
+	}{
+		{"TestSingleDay", "2023-07-02", "2023-07-02", 24},
+		{"TestMultipleDays", "2023-07-01", "2023-07-03", 72},
+		{"TestNoDataInRange", "2023-08-01", "2023-08-31", 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{API: "api", App: "app", Limit: 10, Mac: "00:11:22:33:44:55"}
+
+			got, err := GetHistoricalDataBetween(ctx, fd, s.URL, "/v1", tt.start, tt.end,
+				WithClientOptions(testClientOptions()))
+			if err != nil {
+				t.Fatalf("GetHistoricalDataBetween() error = %v", err)
+			}
+
+			start, _ := ConvertTimeToEpoch(tt.start.String())
+			end, _ := ConvertTimeToEpoch(tt.end.String())
+
+			count := 0
+			for _, page := range got {
+				for _, record := range page {
+					if record.Dateutc < start || record.Dateutc >= end+epochIncrement24h {
+						t.Errorf("GetHistoricalDataBetween() record %v is outside of %v to %v", record.Dateutc, tt.start, tt.end)
+					}
+					count++
+				}
+			}
+
+			if count != tt.want {
+				t.Errorf("GetHistoricalDataBetween() returned %v records, want %v", count, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataFinalDay(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 7, 5, 12, 30, 0, 0, time.UTC)
+	clock := WithClock(fixedClock(now))
+
+	// hourly records from 2023-07-04 01:00 through 2023-07-05 23:00, newest first, so
+	// some of them are in the future of the pinned clock
+	last := time.Date(2023, 7, 5, 23, 0, 0, 0, time.UTC)
+	records := make([]int64, 47)
+	for i := range records {
+		records[i] = last.Add(-time.Duration(i) * time.Hour).UnixMilli()
+	}
+
+	tests := []struct {
+		name  string
+		fetch func(ctx context.Context, fd FunctionData, url string) ([]DeviceDataResponse, error)
+		want  int
+	}{
+		{"TestEpochWithinLastDay", func(ctx context.Context, fd FunctionData, url string) ([]DeviceDataResponse, error) {
+			fd.Epoch = now.Add(-3 * time.Hour).UnixMilli()
+			return GetHistoricalData(ctx, fd, url, "/v1", WithClientOptions(testClientOptions()), clock)
+		}, 3},
+		{"TestEpochIsNow", func(ctx context.Context, fd FunctionData, url string) ([]DeviceDataResponse, error) {
+			fd.Epoch = now.UnixMilli()
+			return GetHistoricalData(ctx, fd, url, "/v1", WithClientOptions(testClientOptions()), clock)
+		}, 0},
+		{"TestBetweenEndsToday", func(ctx context.Context, fd FunctionData, url string) ([]DeviceDataResponse, error) {
+			return GetHistoricalDataBetween(ctx, fd, url, "/v1", "2023-07-05", "2023-07-05",
+				WithClientOptions(testClientOptions()), clock)
+		}, 13},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			var endDates []string
+			records := pagedHandler(records, false)
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					endDates = append(endDates, r.URL.Query().Get("endDate"))
+					mu.Unlock()
+					records(w, r)
+				}))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{API: "api", App: "app", Limit: 10, Mac: "00:11:22:33:44:55"}
+
+			got, err := tt.fetch(ctx, fd, s.URL)
+			if err != nil {
+				t.Fatalf("fetch error = %v", err)
+			}
+
+			if count := len(Flatten(got)); count != tt.want {
+				t.Errorf("fetch returned %v records, want %v", count, tt.want)
+			}
+			for _, record := range Flatten(got) {
+				if record.Dateutc >= now.UnixMilli() {
+					t.Errorf("fetch returned record %v, which is after the pinned clock", record.Dateutc)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if want := strconv.FormatInt(now.UnixMilli(), 10); len(endDates) == 0 || endDates[0] != want {
+				t.Errorf("fetch endDates = %v, want the first one clamped to %v", endDates, want)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataBetweenErrors(t *testing.T) {
+	t.Parallel()
+	fd := FunctionData{API: "api", App: "app", Limit: 10, Mac: "00:11:22:33:44:55"}
+
+	tests := []struct {
+		name    string
+		start   YearMonthDay
+		end     YearMonthDay
+		wantErr error
+		wantMsg string
+	}{
+		{"TestStartAfterEnd", "2023-07-31", "2023-07-01", ErrInvalidDateRange,
+			"start date is after end date: 2023-07-31 is after 2023-07-01"},
+		{"TestMalformedStart", "July 1st", "2023-07-31", ErrMalformedDate, ""},
+		{"TestMalformedEnd", "2023-07-01", "31/07/2023", ErrMalformedDate, ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := GetHistoricalDataBetween(context.Background(), fd, "http://127.0.0.1", "/v1",
+				tt.start, tt.end, WithClientOptions(testClientOptions()))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetHistoricalDataBetween() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && fmt.Sprint(err) != tt.wantMsg {
+				t.Errorf("GetHistoricalDataBetween() error = %q, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestGetMostRecent(t *testing.T) {
+	t.Parallel()
+	var (
+		calls int32
+		limit string
+		path  string
+	)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			limit = r.URL.Query().Get("limit")
+			path = r.URL.Path
+			_, _ = w.Write([]byte(`[{"dateutc":1697142300000,"tempf":85.8,"dailyrainin":0.123}]`))
+		}))
+	defer s.Close()
+
+	fd := FunctionData{API: "api", App: "app", Limit: 288}
+
+	got, err := GetMostRecent(context.Background(), fd, "00:11:22:33:44:55", s.URL, "/v1",
+		WithClientOptions(testClientOptions()))
+	if err != nil {
+		t.Fatalf("GetMostRecent() error = %v", err)
+	}
+
+	want := WeatherRecord{Dateutc: 1697142300000, Tempf: 85.8, Dailyrainin: 0.123}
+	if got != want {
+		t.Errorf("GetMostRecent() = %v, want %v", got, want)
+	}
+	if calls != 1 || limit != "1" {
+		t.Errorf("GetMostRecent() made %v calls with limit=%v, want 1 call with limit=1", calls, limit)
+	}
+	if path != "/v1/devices/00:11:22:33:44:55" {
+		t.Errorf("GetMostRecent() path = %v, want /v1/devices/00:11:22:33:44:55", path)
+	}
+}
+
+func TestGetMostRecentNoRecords(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	defer s.Close()
+
+	_, err := GetMostRecent(context.Background(), FunctionData{API: "api", App: "app"},
+		"00:11:22:33:44:55", s.URL, "/v1", WithClientOptions(testClientOptions()))
+	if err == nil {
+		t.Errorf("GetMostRecent() error = %v, want an error", err)
+	}
+}
+
+func TestCheckLimit(t *testing.T) {
+	t.Parallel()
+	var limit string
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit = r.URL.Query().Get("limit")
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	t.Cleanup(s.Close)
+
+	tests := []struct {
+		name      string
+		limit     int
+		wantLimit string
+		wantErr   error
+	}{
+		{"TestZero", 0, "", ErrInvalidLimit},
+		{"TestNegative", -5, "", ErrInvalidLimit},
+		{"TestOne", 1, "1", nil},
+		{"TestMaximum", 288, "288", nil},
+		{"TestAboveMaximum", 1000, "288", nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			limit = ""
+			fd := FunctionData{API: "api", App: "app", Epoch: 1697142300000, Limit: tt.limit, Mac: "00:11:22:33:44:55"}
+
+			_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getDeviceData() error = %v, want %v", err, tt.wantErr)
+			}
+			if limit != tt.wantLimit {
+				t.Errorf("getDeviceData() sent limit = %q, want %q", limit, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package awn
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+const (
+	// hPaPerInHg is the number of hectopascals in one inch of mercury.
+	hPaPerInHg = 33.8638866667
+
+	// kmPerMile is the number of kilometers in one mile.
+	kmPerMile = 1.609344
+
+	// mmPerInch is the number of millimeters in one inch.
+	mmPerInch = 25.4
+
+	// heatIndexMinTempf is the temperature, in degrees Fahrenheit, above which
+	// ApparentTemperature uses the heat index.
+	heatIndexMinTempf = 80.0
+
+	// windChillMaxTempf is the temperature, in degrees Fahrenheit, below which
+	// ApparentTemperature uses the wind chill. The NWS formula is only defined at or
+	// below 50°F.
+	windChillMaxTempf = 50.0
+
+	// windChillMinWindspeedmph is the wind speed, in miles per hour, below which the NWS
+	// wind chill formula is not defined.
+	windChillMinWindspeedmph = 3.0
+
+	// compassSectorDegrees is the width, in degrees, of each of the 16 points of the
+	// compass rose.
+	compassSectorDegrees = 360.0 / 16
+
+	// magnusB and magnusC are the coefficients of the Magnus formula for the saturation
+	// vapor pressure over water, as given by Sonntag (1990). They are accurate to within
+	// 0.35°C between -45°C and 60°C.
+	magnusB = 17.62
+	magnusC = 243.12
+
+	// wattsPerSquareMeterPerLux is the solar irradiance, in W/m², of one lux of sunlight.
+	// It is an approximation, since the ratio depends on the spectrum of the light, but it
+	// is the usual one for daylight.
+	wattsPerSquareMeterPerLux = 0.0079
+
+	// uvModerate, uvHigh, uvVeryHigh and uvExtreme are the lowest UV index of each WHO
+	// exposure category above Low.
+	uvModerate = 3
+	uvHigh     = 6
+	uvVeryHigh = 8
+	uvExtreme  = 11
+
+	// dewPointToleranceF is how far, in degrees Fahrenheit, a dew point of exactly zero
+	// can be from the computed dew point for HasDewPoint to treat it as a real reading.
+	dewPointToleranceF = 2.0
+)
+
+// MetricWeatherRecord is a WeatherRecord with every imperial field converted to metric
+// units: temperatures in degrees Celsius, speeds in kilometers per hour, pressures in
+// hectopascals and rainfall in millimeters. Fields that are not unit-bearing (i.e.
+// humidity, UV index or wind direction) are copied as-is.
+type MetricWeatherRecord struct {
+	Baromabshpa       float64   `json:"baromabshpa"`
+	Baromrelhpa       float64   `json:"baromrelhpa"`
+	Batt1             *int      `json:"batt1,omitempty"`
+	Battin            *int      `json:"battin,omitempty"`
+	BattLightning     int       `json:"batt_lightning"`
+	Battout           *int      `json:"battout,omitempty"`
+	Co2               *float64  `json:"co2,omitempty"`
+	Dailyrainmm       float64   `json:"dailyrainmm"`
+	Date              time.Time `json:"date"`
+	Dateutc           int64     `json:"dateutc"`
+	DewPointc         float64   `json:"dewPointc"`
+	DewPointinc       float64   `json:"dewPointinc"`
+	Eventrainmm       float64   `json:"eventrainmm"`
+	FeelsLikec        float64   `json:"feelsLikec"`
+	FeelsLikeinc      float64   `json:"feelsLikeinc"`
+	Hourlyrainmm      float64   `json:"hourlyrainmm"`
+	Humidity          int       `json:"humidity"`
+	Humidityin        int       `json:"humidityin"`
+	LastRain          time.Time `json:"lastRain"`
+	LightningDay      int       `json:"lightning_day"`
+	LightningDistance float64   `json:"lightning_distance"`
+	LightningHour     int       `json:"lightning_hour"`
+	LightningTime     int64     `json:"lightning_time"`
+	Maxdailygustkmh   float64   `json:"maxdailygustkmh"`
+	Monthlyrainmm     float64   `json:"monthlyrainmm"`
+	Pm25              *float64  `json:"pm25,omitempty"`
+	Pm2524H           *float64  `json:"pm25_24h,omitempty"`
+	Soiltemp1c        *float64  `json:"soiltemp1c,omitempty"`
+	Solarradiation    float64   `json:"solarradiation"`
+	Tempc             float64   `json:"tempc"`
+	Tempinc           float64   `json:"tempinc"`
+	Tz                string    `json:"tz"`
+	Uv                int       `json:"uv"`
+	Weeklyrainmm      float64   `json:"weeklyrainmm"`
+	Winddir           int       `json:"winddir"`
+	WinddirAvg10M     int       `json:"winddir_avg10m"`
+	Windgustkmh       float64   `json:"windgustkmh"`
+	WindspdkmhAvg10M  float64   `json:"windspdkmh_avg10m"`
+	Windspeedkmh      float64   `json:"windspeedkmh"`
+	Yearlyrainmm      float64   `json:"yearlyrainmm"`
+}
+
+// String is a helper function to print the MetricWeatherRecord struct as a string.
+func (m MetricWeatherRecord) String() string {
+	r, _ := json.Marshal(m)
+
+	return string(r)
+}
+
+// TempC is a public method that returns the outdoor temperature in degrees Celsius.
+func (w WeatherRecord) TempC() float64 {
+	return fahrenheitToCelsius(w.Tempf)
+}
+
+// TempInC is a public method that returns the indoor temperature in degrees Celsius.
+func (w WeatherRecord) TempInC() float64 {
+	return fahrenheitToCelsius(w.Tempinf)
+}
+
+// DewPointC is a public method that returns the outdoor dew point in degrees Celsius.
+func (w WeatherRecord) DewPointC() float64 {
+	return fahrenheitToCelsius(w.DewPoint)
+}
+
+// FeelsLikeC is a public method that returns the outdoor feels-like temperature in
+// degrees Celsius.
+func (w WeatherRecord) FeelsLikeC() float64 {
+	return fahrenheitToCelsius(w.FeelsLike)
+}
+
+// WindSpeedKMH is a public method that returns the wind speed in kilometers per hour.
+func (w WeatherRecord) WindSpeedKMH() float64 {
+	return w.Windspeedmph * kmPerMile
+}
+
+// WindGustKMH is a public method that returns the wind gust speed in kilometers per hour.
+func (w WeatherRecord) WindGustKMH() float64 {
+	return w.Windgustmph * kmPerMile
+}
+
+// BarometricHPa is a public method that returns the relative (sea-level) barometric
+// pressure in hectopascals.
+func (w WeatherRecord) BarometricHPa() float64 {
+	return w.Baromrelin * hPaPerInHg
+}
+
+// RainMM is a public method that returns the rainfall since midnight in millimeters.
+func (w WeatherRecord) RainMM() float64 {
+	return w.Dailyrainin * mmPerInch
+}
+
+// WindCardinal is a public method that returns the wind direction as one of the 16
+// points of the compass rose (i.e. "N", "NNE" or "NE"). Each point covers 22.5 degrees,
+// centered on its direction, so 349 to 11 degrees is "N".
+func (w WeatherRecord) WindCardinal() string {
+	return cardinal(w.Winddir)
+}
+
+// WindCardinalAvg10m is a public method that works like WindCardinal, but for the
+// average wind direction over the last 10 minutes.
+func (w WeatherRecord) WindCardinalAvg10m() string {
+	return cardinal(w.WinddirAvg10M)
+}
+
+// cardinal is a private helper function that maps a direction in degrees to one of the
+// 16 points of the compass rose. Directions outside of 0 to 360 degrees wrap around.
+func cardinal(degrees int) string {
+	points := [16]string{
+		"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE",
+		"S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW",
+	}
+
+	normalized := math.Mod(float64(degrees), 360)
+	if normalized < 0 {
+		normalized += 360
+	}
+
+	sector := int(math.Floor((normalized+compassSectorDegrees/2)/compassSectorDegrees)) % len(points)
+
+	return points[sector]
+}
+
+// SolarLux is a public method that returns the illuminance of the sunlight, in lux,
+// converted from the solar radiation in W/m² with the usual daylight factor of 0.0079
+// W/m² per lux. It is an estimate, good enough for decisions such as turning the lights
+// on, but not a replacement for a light meter.
+func (w WeatherRecord) SolarLux() float64 {
+	return w.Solarradiation / wattsPerSquareMeterPerLux
+}
+
+// UVCategory is a public method that returns the WHO exposure category of the UV index:
+// "Low" (0 to 2), "Moderate" (3 to 5), "High" (6 and 7), "Very High" (8 to 10) or
+// "Extreme" (11 and above).
+func (w WeatherRecord) UVCategory() string {
+	switch {
+	case w.Uv >= uvExtreme:
+		return "Extreme"
+	case w.Uv >= uvVeryHigh:
+		return "Very High"
+	case w.Uv >= uvHigh:
+		return "High"
+	case w.Uv >= uvModerate:
+		return "Moderate"
+	default:
+		return "Low"
+	}
+}
+
+// HeatIndex is a public method that returns the heat index, in degrees Fahrenheit, for
+// the outdoor temperature and humidity of the WeatherRecord. It follows the NWS
+// algorithm: the simple Steadman formula is used when it gives less than 80°F, and the
+// Rothfusz regression, with its low and high humidity adjustments, is used otherwise.
+func (w WeatherRecord) HeatIndex() float64 {
+	t := w.Tempf
+	rh := float64(w.Humidity)
+
+	simple := 0.5 * (t + 61.0 + (t-68.0)*1.2 + rh*0.094)
+	if (simple+t)/2 < heatIndexMinTempf {
+		return simple
+	}
+
+	hi := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+		0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+		0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+	switch {
+	case rh < 13 && t >= 80 && t <= 112:
+		hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+	case rh > 85 && t >= 80 && t <= 87:
+		hi += (rh - 85) / 10 * ((87 - t) / 5)
+	}
+
+	return hi
+}
+
+// WindChill is a public method that returns the wind chill, in degrees Fahrenheit, for
+// the outdoor temperature and wind speed of the WeatherRecord, using the NWS formula.
+// The formula is only defined at or below 50°F with winds of at least 3 mph, so the
+// outdoor temperature is returned as-is otherwise.
+func (w WeatherRecord) WindChill() float64 {
+	t := w.Tempf
+	if t > windChillMaxTempf || w.Windspeedmph < windChillMinWindspeedmph {
+		return t
+	}
+
+	v := math.Pow(w.Windspeedmph, 0.16)
+
+	return 35.74 + 0.6215*t - 35.75*v + 0.4275*t*v
+}
+
+// ApparentTemperature is a public method that returns how warm or cold it feels
+// outside, in degrees Fahrenheit: the heat index above 80°F, the wind chill below 50°F
+// and the outdoor temperature in between. Unlike FeelsLike, it is always derived from
+// the other fields, so it works for stations that do not report it.
+func (w WeatherRecord) ApparentTemperature() float64 {
+	switch {
+	case w.Tempf > heatIndexMinTempf:
+		return w.HeatIndex()
+	case w.Tempf < windChillMaxTempf:
+		return w.WindChill()
+	default:
+		return w.Tempf
+	}
+}
+
+// HasDewPoint is a public method that reports whether the station seems to have reported
+// DewPoint. Stations that do not report it send a dew point of 0, which looks like a real
+// reading, so a dew point of 0 only counts when ComputeDewPoint agrees that it is close
+// to 0°F.
+func (w WeatherRecord) HasDewPoint() bool {
+	if w.DewPoint != 0 {
+		return true
+	}
+
+	return math.Abs(w.ComputeDewPoint()) <= dewPointToleranceF
+}
+
+// ComputeDewPoint is a public method that returns the dew point, in degrees Fahrenheit to
+// match the rest of the WeatherRecord, computed from the outdoor temperature and
+// humidity with the Magnus formula. It can be used to fill in DewPoint when HasDewPoint
+// is false. It returns NaN when the humidity is 0 or less, since the dew point is not
+// defined for perfectly dry air.
+//
+// Basic Usage:
+//
+//	if !record.HasDewPoint() {
+//		record.DewPoint = record.ComputeDewPoint()
+//	}
+func (w WeatherRecord) ComputeDewPoint() float64 {
+	if w.Humidity <= 0 {
+		return math.NaN()
+	}
+
+	t := fahrenheitToCelsius(w.Tempf)
+	gamma := math.Log(float64(w.Humidity)/100) + magnusB*t/(magnusC+t)
+
+	return celsiusToFahrenheit(magnusC * gamma / (magnusB - gamma))
+}
+
+// ToMetric is a public method that returns a MetricWeatherRecord with every field of the
+// WeatherRecord converted to metric units. The API has no way to ask for metric units
+// itself, so this is the only way to get them.
+//
+// Basic Usage:
+//
+//	for _, record := range data {
+//		fmt.Println(record.ToMetric().Tempc)
+//	}
+func (w WeatherRecord) ToMetric() MetricWeatherRecord {
+	return MetricWeatherRecord{
+		Baromabshpa:       w.Baromabsin * hPaPerInHg,
+		Baromrelhpa:       w.BarometricHPa(),
+		Batt1:             w.Batt1,
+		Battin:            w.Battin,
+		BattLightning:     w.BattLightning,
+		Battout:           w.Battout,
+		Co2:               w.Co2,
+		Dailyrainmm:       w.RainMM(),
+		Date:              w.Date,
+		Dateutc:           w.Dateutc,
+		DewPointc:         w.DewPointC(),
+		DewPointinc:       fahrenheitToCelsius(w.DewPointin),
+		Eventrainmm:       w.Eventrainin * mmPerInch,
+		FeelsLikec:        w.FeelsLikeC(),
+		FeelsLikeinc:      fahrenheitToCelsius(w.FeelsLikein),
+		Hourlyrainmm:      w.Hourlyrainin * mmPerInch,
+		Humidity:          w.Humidity,
+		Humidityin:        w.Humidityin,
+		LastRain:          w.LastRain,
+		LightningDay:      w.LightningDay,
+		LightningDistance: w.LightningDistance,
+		LightningHour:     w.LightningHour,
+		LightningTime:     w.LightningTime,
+		Maxdailygustkmh:   w.Maxdailygust * kmPerMile,
+		Monthlyrainmm:     w.Monthlyrainin * mmPerInch,
+		Pm25:              w.Pm25,
+		Pm2524H:           w.Pm2524H,
+		Soiltemp1c:        soilTempC(w.Soiltemp1),
+		Solarradiation:    w.Solarradiation,
+		Tempc:             w.TempC(),
+		Tempinc:           w.TempInC(),
+		Tz:                w.Tz,
+		Uv:                w.Uv,
+		Weeklyrainmm:      w.Weeklyrainin * mmPerInch,
+		Winddir:           w.Winddir,
+		WinddirAvg10M:     w.WinddirAvg10M,
+		Windgustkmh:       w.WindGustKMH(),
+		WindspdkmhAvg10M:  w.WindspdmphAvg10M * kmPerMile,
+		Windspeedkmh:      w.WindSpeedKMH(),
+		Yearlyrainmm:      w.Yearlyrainin * mmPerInch,
+	}
+}
+
+// ToMetric is a public method that converts every record in the DeviceDataResponse to
+// metric units, keeping the original order.
+func (d DeviceDataResponse) ToMetric() []MetricWeatherRecord {
+	metric := make([]MetricWeatherRecord, len(d))
+	for i, record := range d {
+		metric[i] = record.ToMetric()
+	}
+
+	return metric
+}
+
+// soilTempC is a private helper function that converts an optional soil temperature from
+// degrees Fahrenheit to degrees Celsius, keeping nil when the sensor did not report.
+func soilTempC(tempf *float64) *float64 {
+	if tempf == nil {
+		return nil
+	}
+
+	tempc := fahrenheitToCelsius(*tempf)
+
+	return &tempc
+}
+
+// fahrenheitToCelsius is a private helper function that converts a temperature from
+// degrees Fahrenheit to degrees Celsius.
+func fahrenheitToCelsius(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+// celsiusToFahrenheit is a private helper function that converts a temperature from
+// degrees Celsius to degrees Fahrenheit.
+func celsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
@@ -0,0 +1,301 @@
+package awn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWeatherRecordConversions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		got  func(WeatherRecord) float64
+		r    WeatherRecord
+		want float64
+	}{
+		{"TestTempCFreezing", WeatherRecord.TempC, WeatherRecord{Tempf: 32}, 0},
+		{"TestTempCBoiling", WeatherRecord.TempC, WeatherRecord{Tempf: 212}, 100},
+		{"TestTempCCrossover", WeatherRecord.TempC, WeatherRecord{Tempf: -40}, -40},
+		{"TestTempInC", WeatherRecord.TempInC, WeatherRecord{Tempinf: 68}, 20},
+		{"TestDewPointC", WeatherRecord.DewPointC, WeatherRecord{DewPoint: 50}, 10},
+		{"TestFeelsLikeC", WeatherRecord.FeelsLikeC, WeatherRecord{FeelsLike: 95}, 35},
+		{"TestWindSpeedKMH", WeatherRecord.WindSpeedKMH, WeatherRecord{Windspeedmph: 10}, 16.09344},
+		{"TestWindGustKMH", WeatherRecord.WindGustKMH, WeatherRecord{Windgustmph: 62.137119}, 100},
+		{"TestBarometricHPa", WeatherRecord.BarometricHPa, WeatherRecord{Baromrelin: 29.92}, 1013.2075},
+		{"TestRainMM", WeatherRecord.RainMM, WeatherRecord{Dailyrainin: 1.5}, 38.1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.got(tt.r); math.Abs(got-tt.want) > 1e-3 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToMetric(t *testing.T) {
+	t.Parallel()
+	r := WeatherRecord{
+		Baromabsin: 29.92, Dailyrainin: 1, DewPoint: 50, DewPointin: 41, FeelsLike: 86,
+		FeelsLikein: 77, Humidity: 55, Tempf: 86, Tempinf: 68, Tz: "America/Chicago",
+		Uv: 3, Winddir: 270, Windgustmph: 20, Windspeedmph: 10, Yearlyrainin: 40,
+	}
+
+	m := r.ToMetric()
+
+	floats := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"Baromabshpa", m.Baromabshpa, 1013.2075},
+		{"Dailyrainmm", m.Dailyrainmm, 25.4},
+		{"DewPointc", m.DewPointc, 10},
+		{"DewPointinc", m.DewPointinc, 5},
+		{"FeelsLikec", m.FeelsLikec, 30},
+		{"FeelsLikeinc", m.FeelsLikeinc, 25},
+		{"Tempc", m.Tempc, 30},
+		{"Tempinc", m.Tempinc, 20},
+		{"Windgustkmh", m.Windgustkmh, 32.18688},
+		{"Windspeedkmh", m.Windspeedkmh, 16.09344},
+		{"Yearlyrainmm", m.Yearlyrainmm, 1016},
+	}
+	for _, f := range floats {
+		if math.Abs(f.got-f.want) > 1e-3 {
+			t.Errorf("ToMetric().%v = %v, want %v", f.name, f.got, f.want)
+		}
+	}
+
+	if m.Humidity != 55 || m.Uv != 3 || m.Winddir != 270 || m.Tz != "America/Chicago" {
+		t.Errorf("ToMetric() = %v, want unitless fields copied as-is", m)
+	}
+
+	if got := (DeviceDataResponse{r, r}).ToMetric(); len(got) != 2 || got[1] != m {
+		t.Errorf("DeviceDataResponse.ToMetric() = %v, want two copies of %v", got, m)
+	}
+}
+
+func TestWindCardinal(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		winddir int
+		want    string
+	}{
+		{"TestNorth", 0, "N"},
+		{"TestNorthNorthEast", 22, "NNE"},
+		{"TestNorthEast", 45, "NE"},
+		{"TestEastNorthEast", 68, "ENE"},
+		{"TestEast", 90, "E"},
+		{"TestEastSouthEast", 112, "ESE"},
+		{"TestSouthEast", 135, "SE"},
+		{"TestSouthSouthEast", 158, "SSE"},
+		{"TestSouth", 180, "S"},
+		{"TestSouthSouthWest", 202, "SSW"},
+		{"TestSouthWest", 225, "SW"},
+		{"TestWestSouthWest", 248, "WSW"},
+		{"TestWest", 270, "W"},
+		{"TestWestNorthWest", 292, "WNW"},
+		{"TestNorthWest", 315, "NW"},
+		{"TestNorthNorthWest", 338, "NNW"},
+		{"TestLastDegreeOfNorthNorthWest", 348, "NNW"},
+		{"TestFirstDegreeOfNorth", 349, "N"},
+		{"TestLastDegreeOfNorth", 11, "N"},
+		{"TestFirstDegreeOfNorthNorthEast", 12, "NNE"},
+		{"TestFullCircle", 360, "N"},
+		{"TestAboveFullCircle", 405, "NE"},
+		{"TestNegative", -90, "W"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := WeatherRecord{Winddir: tt.winddir, WinddirAvg10M: tt.winddir}
+			if got := r.WindCardinal(); got != tt.want {
+				t.Errorf("WindCardinal(%v) = %v, want %v", tt.winddir, got, tt.want)
+			}
+			if got := r.WindCardinalAvg10m(); got != tt.want {
+				t.Errorf("WindCardinalAvg10m(%v) = %v, want %v", tt.winddir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUVCategory(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		uv   int
+		want string
+	}{
+		{0, "Low"},
+		{2, "Low"},
+		{3, "Moderate"},
+		{5, "Moderate"},
+		{6, "High"},
+		{7, "High"},
+		{8, "Very High"},
+		{10, "Very High"},
+		{11, "Extreme"},
+		{14, "Extreme"},
+	}
+	for _, tt := range tests {
+		if got := (WeatherRecord{Uv: tt.uv}).UVCategory(); got != tt.want {
+			t.Errorf("UVCategory(%v) = %v, want %v", tt.uv, got, tt.want)
+		}
+	}
+}
+
+func TestSolarLux(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		solarradiation float64
+		want           float64
+	}{
+		{0, 0},
+		{0.0079, 1},
+		{790, 100000},
+		{123.45, 15626.58},
+	}
+	for _, tt := range tests {
+		if got := (WeatherRecord{Solarradiation: tt.solarradiation}).SolarLux(); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("SolarLux(%v) = %v, want %v", tt.solarradiation, got, tt.want)
+		}
+	}
+}
+
+func TestHeatIndex(t *testing.T) {
+	t.Parallel()
+	// reference values from the NWS heat index chart, which are rounded to a degree
+	tests := []struct {
+		name     string
+		tempf    float64
+		humidity int
+		want     float64
+	}{
+		{"Test80F40Percent", 80, 40, 80},
+		{"Test90F50Percent", 90, 50, 95},
+		{"Test100F40Percent", 100, 40, 109},
+		{"Test96F65Percent", 96, 65, 121},
+		{"Test86F90Percent", 86, 90, 105},
+		{"Test104F40Percent", 104, 40, 119},
+		{"TestBelowRegression", 70, 50, 69},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := WeatherRecord{Tempf: tt.tempf, Humidity: tt.humidity}
+			if got := r.HeatIndex(); math.Round(got) != tt.want {
+				t.Errorf("HeatIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindChill(t *testing.T) {
+	t.Parallel()
+	// reference values from the NWS wind chill chart, which are rounded to a degree
+	tests := []struct {
+		name         string
+		tempf        float64
+		windspeedmph float64
+		want         float64
+	}{
+		{"Test40F5mph", 40, 5, 36},
+		{"Test30F10mph", 30, 10, 21},
+		{"Test0F15mph", 0, 15, -19},
+		{"TestMinus10F30mph", -10, 30, -39},
+		{"Test5F60mph", 5, 60, -26},
+		{"TestCalm", 20, 2, 20},
+		{"TestTooWarm", 60, 20, 60},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := WeatherRecord{Tempf: tt.tempf, Windspeedmph: tt.windspeedmph}
+			if got := r.WindChill(); math.Round(got) != tt.want {
+				t.Errorf("WindChill() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApparentTemperature(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		r    WeatherRecord
+		want float64
+	}{
+		{"TestHot", WeatherRecord{Tempf: 90, Humidity: 50, Windspeedmph: 10}, 95},
+		{"TestCold", WeatherRecord{Tempf: 30, Humidity: 50, Windspeedmph: 10}, 21},
+		{"TestMild", WeatherRecord{Tempf: 65, Humidity: 90, Windspeedmph: 20}, 65},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.r.ApparentTemperature(); math.Round(got) != tt.want {
+				t.Errorf("ApparentTemperature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeDewPoint(t *testing.T) {
+	t.Parallel()
+	// reference values from the NWS dew point tables, rounded to a degree
+	tests := []struct {
+		name     string
+		tempf    float64
+		humidity int
+		want     float64
+	}{
+		{"Test77F60Percent", 77, 60, 62},
+		{"Test86F50Percent", 86, 50, 65},
+		{"Test95F30Percent", 95, 30, 59},
+		{"Test50F80Percent", 50, 80, 44},
+		{"TestSaturated", 32, 100, 32},
+		{"TestBelowFreezing", 20, 70, 12},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := WeatherRecord{Tempf: tt.tempf, Humidity: tt.humidity}
+			if got := r.ComputeDewPoint(); math.Round(got) != tt.want {
+				t.Errorf("ComputeDewPoint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := (WeatherRecord{Tempf: 70}).ComputeDewPoint(); !math.IsNaN(got) {
+		t.Errorf("ComputeDewPoint() with no humidity = %v, want NaN", got)
+	}
+}
+
+func TestHasDewPoint(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		r    WeatherRecord
+		want bool
+	}{
+		{"TestReported", WeatherRecord{Tempf: 77, Humidity: 60, DewPoint: 62}, true},
+		{"TestMissing", WeatherRecord{Tempf: 77, Humidity: 60, DewPoint: 0}, false},
+		{"TestRealZero", WeatherRecord{Tempf: 10, Humidity: 62, DewPoint: 0}, true},
+		{"TestNoHumidity", WeatherRecord{Tempf: 10}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.r.HasDewPoint(); got != tt.want {
+				t.Errorf("HasDewPoint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,24 @@
 package awn
 
 import (
+	"container/heap"
 	"encoding/json"
-	"log"
+	"slices"
 	"time"
 )
 
 // FunctionData is a struct that is used to pass data basic API call parameters more
-// easily. It contains API (API key), App (Application key), Epoch (Unix epoch time in
-// milliseconds), Limit (maximum number of records to return in a single API call), and
-// Mac (MAC address of the weather station).
+// easily. It contains API (API key), APIKeys (any additional API keys, used by
+// GetLatestData), App (Application key), Epoch (Unix epoch time in milliseconds), Limit
+// (maximum number of records to return in a single API call), and Mac (MAC address of
+// the weather station).
 type FunctionData struct {
-	API   string `json:"api"`
-	App   string `json:"app"`
-	Epoch int64  `json:"epoch"`
-	Limit int    `json:"limit"`
-	Mac   string `json:"mac"`
+	API     string   `json:"api"`
+	APIKeys []string `json:"apiKeys,omitempty"`
+	App     string   `json:"app"`
+	Epoch   int64    `json:"epoch"`
+	Limit   int      `json:"limit"`
+	Mac     string   `json:"mac"`
 }
 
 // String is a helper function to print the FunctionData struct as a string.
@@ -36,24 +39,192 @@ func (f FunctionData) ToMap() map[string]interface{} {
 	}
 }
 
+// authParams is a private helper function that returns the query parameters that every
+// call to the API needs to authenticate. The API only takes the keys as query
+// parameters, not as headers, so they are redacted from the logs instead (see
+// redactKeys). Requests get them from authRequest, rather than setting them on their own.
+func (f FunctionData) authParams() map[string]string {
+	return map[string]string{
+		"apiKey":         f.API,
+		"applicationKey": f.App,
+	}
+}
+
 // NewFunctionData creates a new FunctionData object with bare default values and return
 // it to the caller as a pointer.
 func NewFunctionData() *FunctionData {
 	return &FunctionData{
-		API:   "",
-		App:   "",
-		Epoch: 0,
-		Limit: 1,
-		Mac:   "",
+		API:     "",
+		APIKeys: nil,
+		App:     "",
+		Epoch:   0,
+		Limit:   1,
+		Mac:     "",
 	}
 }
 
-// DeviceDataResponse is used to marshal/unmarshal the response from the
-// devices/macAddress endpoint.
-type DeviceDataResponse struct {
+// FunctionDataBuilder is a fluent builder for FunctionData, which names every field it
+// sets, so callers do not depend on the order of the fields of the struct. It starts out
+// with the same defaults as NewFunctionData.
+type FunctionDataBuilder struct {
+	data FunctionData
+}
+
+// NewFunctionDataBuilder is a public function that returns a FunctionDataBuilder with
+// the defaults of NewFunctionData.
+//
+// Basic Usage:
+//
+//	funcData, err := awn.NewFunctionDataBuilder().
+//		WithAPI(apiKey).
+//		WithApp(appKey).
+//		WithMac("00:11:22:33:44:55").
+//		WithLimit(288).
+//		Build()
+func NewFunctionDataBuilder() *FunctionDataBuilder {
+	return &FunctionDataBuilder{data: *NewFunctionData()}
+}
+
+// WithAPI is a public method that sets the API key.
+func (b *FunctionDataBuilder) WithAPI(key string) *FunctionDataBuilder {
+	b.data.API = key
+	return b
+}
+
+// WithAPIKeys is a public method that sets the additional API keys that are used by
+// GetLatestData.
+func (b *FunctionDataBuilder) WithAPIKeys(keys ...string) *FunctionDataBuilder {
+	b.data.APIKeys = keys
+	return b
+}
+
+// WithApp is a public method that sets the Application key.
+func (b *FunctionDataBuilder) WithApp(key string) *FunctionDataBuilder {
+	b.data.App = key
+	return b
+}
+
+// WithMac is a public method that sets the MAC address of the weather station.
+func (b *FunctionDataBuilder) WithMac(mac string) *FunctionDataBuilder {
+	b.data.Mac = mac
+	return b
+}
+
+// WithLimit is a public method that sets the maximum number of records to return in a
+// single API call.
+func (b *FunctionDataBuilder) WithLimit(limit int) *FunctionDataBuilder {
+	b.data.Limit = limit
+	return b
+}
+
+// WithEpoch is a public method that sets the epoch time, in milliseconds.
+func (b *FunctionDataBuilder) WithEpoch(epoch int64) *FunctionDataBuilder {
+	b.data.Epoch = epoch
+	return b
+}
+
+// Build is a public method that returns the FunctionData, once it has been checked. Both
+// keys must be set, the limit must be between 1 and 288, and the MAC address, which can
+// be left out for GetLatestData, is put in the form used by the API with
+// NormalizeMacAddress. It returns the error of the first check that fails.
+func (b *FunctionDataBuilder) Build() (FunctionData, error) {
+	data := b.data
+	data.APIKeys = slices.Clone(data.APIKeys)
+
+	err := data.validateKeys()
+	if err != nil {
+		return FunctionData{}, err
+	}
+
+	if data.Limit < 1 || data.Limit > maxLimit {
+		return FunctionData{}, ErrInvalidLimit.with(data.Limit)
+	}
+
+	if data.Mac != "" {
+		data.Mac, err = NormalizeMacAddress(data.Mac)
+		if err != nil {
+			return FunctionData{}, err
+		}
+	}
+
+	return data, nil
+}
+
+// Validate is a public method that checks that every field needed to get the data of a
+// weather station is set. It returns ErrAPIKeyMissing, ErrAppKeyMissing or
+// ErrMacAddressMissing for the first one that is empty, so a call can fail before it is
+// ever sent to the API.
+//
+// Basic Usage:
+//
+//	err := apiConfig.Validate()
+func (f FunctionData) Validate() error {
+	err := f.validateKeys()
+	if err != nil {
+		return err
+	}
+
+	return f.validateMac()
+}
+
+// validateKeys is a private helper function that returns ErrAPIKeyMissing or
+// ErrAppKeyMissing if the API key or the Application key is empty. Unlike Validate, it
+// does not need a MAC address, which the devices endpoint does not use.
+func (f FunctionData) validateKeys() error {
+	if f.API == "" {
+		return ErrAPIKeyMissing
+	}
+
+	if f.App == "" {
+		return ErrAppKeyMissing
+	}
+
+	return nil
+}
+
+// validateMac is a private helper function that returns ErrMacAddressMissing if the MAC
+// address is empty.
+func (f FunctionData) validateMac() error {
+	if f.Mac == "" {
+		return ErrMacAddressMissing
+	}
+
+	return nil
+}
+
+// apiKeys is a private helper function that returns the API key followed by each of the
+// additional APIKeys, skipping any that are empty or repeated.
+func (f FunctionData) apiKeys() []string {
+	keys := []string{f.API}
+	seen := map[string]struct{}{f.API: {}}
+
+	for _, key := range f.APIKeys {
+		if _, ok := seen[key]; ok || key == "" {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// WeatherRecord is a single weather reading as returned by the devices/macAddress
+// endpoint.
+//
+// Batt1, Battin and Battout are pointers, since not every station has those sensors: nil
+// means that the sensor did not report, 1 that its battery is OK and 0 that it is low.
+// The air-quality (Co2, Pm25 and Pm2524H) and soil (Soiltemp1) fields are pointers for
+// the same reason, as zero is a valid reading for them.
+type WeatherRecord struct {
 	Baromabsin        float64   `json:"baromabsin"`
 	Baromrelin        float64   `json:"baromrelin"`
+	Batt1             *int      `json:"batt1,omitempty"`
+	Battin            *int      `json:"battin,omitempty"`
 	BattLightning     int       `json:"batt_lightning"`
+	Battout           *int      `json:"battout,omitempty"`
+	Co2               *float64  `json:"co2,omitempty"`
 	Dailyrainin       float64   `json:"dailyrainin"`
 	Date              time.Time `json:"date"`
 	Dateutc           int64     `json:"dateutc"`
@@ -72,6 +243,9 @@ type DeviceDataResponse struct {
 	LightningTime     int64     `json:"lightning_time"`
 	Maxdailygust      float64   `json:"maxdailygust"`
 	Monthlyrainin     float64   `json:"monthlyrainin"`
+	Pm25              *float64  `json:"pm25,omitempty"`
+	Pm2524H           *float64  `json:"pm25_24h,omitempty"`
+	Soiltemp1         *float64  `json:"soiltemp1,omitempty"`
 	Solarradiation    float64   `json:"solarradiation"`
 	Tempf             float64   `json:"tempf"`
 	Tempinf           float64   `json:"tempinf"`
@@ -86,13 +260,262 @@ type DeviceDataResponse struct {
 	Yearlyrainin      float64   `json:"yearlyrainin"`
 }
 
-// String is a helper function to print the DeviceDataResponse struct as a string.
+// String is a helper function to print the WeatherRecord struct as a string. The record
+// is marshaled to JSON, which writes each float with the fewest digits that still parse
+// back to the exact same value (i.e. 5.254 stays 5.254), so the output is deterministic
+// and round-trips through json.Unmarshal.
+func (w WeatherRecord) String() string {
+	r, _ := json.Marshal(w)
+
+	return string(r)
+}
+
+// Equal is a public method that reports whether two WeatherRecord objects are the same
+// reading: they must have the same Dateutc and the same key measurements (temperature,
+// humidity, pressure, wind, daily rain, solar radiation and UV index). Other fields, such
+// as the time zone or the battery states, are not compared.
+//
+// Basic Usage:
+//
+//	if record.Equal(previous) {
+//		continue
+//	}
+func (w WeatherRecord) Equal(other WeatherRecord) bool {
+	return w.Dateutc == other.Dateutc &&
+		w.Tempf == other.Tempf &&
+		w.Humidity == other.Humidity &&
+		w.Baromrelin == other.Baromrelin &&
+		w.Windspeedmph == other.Windspeedmph &&
+		w.Windgustmph == other.Windgustmph &&
+		w.Winddir == other.Winddir &&
+		w.Dailyrainin == other.Dailyrainin &&
+		w.Solarradiation == other.Solarradiation &&
+		w.Uv == other.Uv
+}
+
+// LocalDate is a public method that returns the time of the reading in the time zone of
+// the weather station, as named by Tz (i.e. "America/Chicago"). It is the same instant as
+// Date, or as Dateutc when Date could not be parsed, so daylight saving time is taken
+// care of by the time zone database. It returns ErrUnknownTimezone if Tz is empty or is
+// not a known time zone.
+//
+// Basic Usage:
+//
+//	local, err := record.LocalDate()
+//	fmt.Println(local.Format(time.Kitchen))
+func (w WeatherRecord) LocalDate() (time.Time, error) {
+	if w.Tz == "" {
+		return time.Time{}, ErrUnknownTimezone
+	}
+
+	location, err := time.LoadLocation(w.Tz)
+	if err != nil {
+		return time.Time{}, ErrUnknownTimezone.withDetail("%q: %w", w.Tz, err)
+	}
+
+	date := w.Date
+	if date.IsZero() {
+		date = time.UnixMilli(w.Dateutc)
+	}
+
+	return date.In(location), nil
+}
+
+// LastLightningTime is a public method that returns the time of the last lightning
+// strike that the sensor detected, from LightningTime, in UTC. It returns the zero time
+// if no strike was ever detected, so check it with IsZero.
+//
+// Basic Usage:
+//
+//	if strike := record.LastLightningTime(); !strike.IsZero() {
+//		fmt.Printf("last strike %v miles away at %v\n", record.LightningDistance, strike)
+//	}
+func (w WeatherRecord) LastLightningTime() time.Time {
+	if w.LightningTime <= 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(w.LightningTime).UTC()
+}
+
+// HasRecentLightning is a public method that reports whether the last lightning strike
+// was detected within the given duration of now. It is false if no strike was ever
+// detected.
+//
+// Basic Usage:
+//
+//	if record.HasRecentLightning(30 * time.Minute) {
+//		fmt.Println("stay inside")
+//	}
+func (w WeatherRecord) HasRecentLightning(within time.Duration) bool {
+	strike := w.LastLightningTime()
+
+	return !strike.IsZero() && time.Since(strike) <= within
+}
+
+// Dedupe is a public function that returns the records without those that have the same
+// Dateutc as an earlier one, keeping the first and the original order. This cleans up
+// records that were fetched twice, such as when two pages or windows overlap.
+//
+// Basic Usage:
+//
+//	records := awn.Dedupe(append(firstWindow, secondWindow...))
+func Dedupe(records []WeatherRecord) []WeatherRecord {
+	return DeviceDataResponse(records).withoutSeen(make(map[int64]struct{}, len(records)))
+}
+
+// MergeRecords is a public function that merges series of records, each sorted by
+// Dateutc from the oldest to the newest, into a single series in the same order. A record
+// with the same Dateutc as one that is already merged is dropped, so when series overlap,
+// the record of the series that was passed first is kept. The series are merged k ways,
+// with a heap that holds the next record of each one, so merging many chunks of a
+// parallel fetch takes O(n log k) time for n records in k series. A series in the order
+// of the API, from the newest to the oldest, must be reversed first.
+//
+// Basic Usage:
+//
+//	records := awn.MergeRecords(januaryRecords, februaryRecords, marchRecords)
+func MergeRecords(series ...[]WeatherRecord) []WeatherRecord {
+	total := 0
+	cursors := make(mergeHeap, 0, len(series))
+
+	for i, records := range series {
+		total += len(records)
+
+		if len(records) > 0 {
+			cursors = append(cursors, mergeCursor{records: records, series: i})
+		}
+	}
+
+	heap.Init(&cursors)
+
+	merged := make([]WeatherRecord, 0, total)
+
+	for len(cursors) > 0 {
+		cursor := &cursors[0]
+		record := cursor.records[0]
+
+		if len(merged) == 0 || record.Dateutc > merged[len(merged)-1].Dateutc {
+			merged = append(merged, record)
+		}
+
+		cursor.records = cursor.records[1:]
+		if len(cursor.records) == 0 {
+			heap.Pop(&cursors)
+		} else {
+			heap.Fix(&cursors, 0)
+		}
+	}
+
+	return merged
+}
+
+// mergeCursor is a private struct that holds the records of a series that MergeRecords
+// has not merged yet, along with the position of the series in its arguments.
+type mergeCursor struct {
+	records []WeatherRecord
+	series  int
+}
+
+// mergeHeap is a private type that implements heap.Interface for MergeRecords. The
+// cursor with the oldest next record comes first, and ties go to the series that was
+// passed first.
+type mergeHeap []mergeCursor
+
+// Len is a public method that returns the number of cursors in the heap.
+func (h mergeHeap) Len() int { return len(h) }
+
+// Less is a public method that reports whether cursor i comes before cursor j.
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].records[0].Dateutc != h[j].records[0].Dateutc {
+		return h[i].records[0].Dateutc < h[j].records[0].Dateutc
+	}
+
+	return h[i].series < h[j].series
+}
+
+// Swap is a public method that swaps cursors i and j.
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Push is a public method that adds a cursor to the end of the heap.
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(mergeCursor)) } //nolint:forcetypeassert
+
+// Pop is a public method that removes and returns the last cursor of the heap.
+func (h *mergeHeap) Pop() any {
+	old := *h
+	cursor := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return cursor
+}
+
+// DeviceDataResponse is used to marshal/unmarshal the response from the
+// devices/macAddress endpoint. The API returns a list of WeatherRecord objects, ordered
+// from newest to oldest.
+type DeviceDataResponse []WeatherRecord
+
+// String is a helper function to print the DeviceDataResponse as a string. Like
+// WeatherRecord.String, it round-trips through json.Unmarshal.
 func (d DeviceDataResponse) String() string {
 	r, _ := json.Marshal(d)
 
 	return string(r)
 }
 
+// Latest is a public method that returns the most recent WeatherRecord in the
+// DeviceDataResponse, which is the one with the highest Dateutc, no matter what order the
+// records are in. The boolean is false if there are no records.
+//
+// Basic Usage:
+//
+//	record, ok := resp.Latest()
+func (d DeviceDataResponse) Latest() (WeatherRecord, bool) {
+	if len(d) == 0 {
+		return WeatherRecord{}, false //nolint:exhaustruct
+	}
+
+	latest := d[0]
+	for _, record := range d[1:] {
+		if record.Dateutc > latest.Dateutc {
+			latest = record
+		}
+	}
+
+	return latest, true
+}
+
+// Flatten is a public function that concatenates the pages returned by functions such
+// as GetHistoricalData into a single list of WeatherRecord objects, keeping the order of
+// the pages and of the records within each page.
+//
+// Basic Usage:
+//
+//	resp, err := awn.GetHistoricalData(ctx, funcData, url, version)
+//	for _, record := range awn.Flatten(resp) {
+//		fmt.Println(record.Tempf)
+//	}
+func Flatten(data []DeviceDataResponse) []WeatherRecord {
+	count := 0
+	for _, page := range data {
+		count += len(page)
+	}
+
+	records := make([]WeatherRecord, 0, count)
+	for _, page := range data {
+		records = append(records, page...)
+	}
+
+	return records
+}
+
+// DeviceDataResult is a struct that is sent on the channel returned by
+// GetHistoricalDataAsync. It carries either one page of records in Data, as returned by
+// a single call to the API, or the error that stopped the stream in Err.
+type DeviceDataResult struct {
+	Data DeviceDataResponse
+	Err  error
+}
+
 // DeviceData is used to marshal/unmarshal the response from the
 // 'devices' API endpoint. This should be removed, since this data is
 // not captured. It's only possible use is for a quasi-real-time data pull.
@@ -132,22 +555,22 @@ type DeviceData struct {
 	Yearlyrainin      float64   `json:"yearlyrainin"`
 }
 
-// This info struct will likely be deleted at some point in the near future since it is
-// never used. It is part of the AmbientDevice and coords structs.
+// geo is a private struct that holds the GeoJSON point of a weather station. It is part
+// of the coords struct.
 type geo struct {
 	Coordinates []float64 `json:"coordinates"`
 	Type        string    `json:"type"`
 }
 
-// This info struct will likely be deleted at some point in the near future since it is
-// never used. It is part of the AmbientDevice and coords structs.
+// specificCoords is a private struct that holds the latitude and longitude of a weather
+// station. It is part of the coords struct.
 type specificCoords struct {
 	Lat float64 `json:"lat"`
 	Lon float64 `json:"lon"`
 }
 
-// This info struct will likely be deleted at some point in the near future since it is
-// never used. It is part of the AmbientDevice and info structs.
+// coords is a private struct that holds the location of a weather station, as entered
+// by its owner. It is part of the info struct.
 type coords struct {
 	Address   string         `json:"address"`
 	Coords    specificCoords `json:"coords"`
@@ -156,27 +579,152 @@ type coords struct {
 	Location  string         `json:"location"`
 }
 
-// This info struct will likely be deleted at some point in the near future since it is
-// never used. It is part of the AmbientDevice struct.
+// info is a private struct that holds the name and the location of a weather station.
+// Use Device.Location or AmbientDevice.Locations to read it.
 type info struct {
 	Coords coords `json:"coords"`
 	Name   string `json:"name"`
 }
 
-// AmbientDevice is a struct that is used in the marshal/unmarshal JSON. This structure
-// is not fully required, since all we use is the MacAddress field. The rest of the data
-// is thrown away.
-type AmbientDevice struct {
+// StationLocation is a struct that describes where a weather station is. Latitude and
+// Longitude are in decimal degrees and Elevation is in meters.
+type StationLocation struct {
+	Address    string  `json:"address"`
+	Elevation  float64 `json:"elevation"`
+	Latitude   float64 `json:"latitude"`
+	Location   string  `json:"location"`
+	Longitude  float64 `json:"longitude"`
+	MacAddress string  `json:"macAddress"`
+	Name       string  `json:"name"`
+}
+
+// Device is a struct that describes a single weather station, as returned by the
+// devices endpoint. LastData holds its most recent reading.
+type Device struct {
 	Info       info       `json:"info"`
-	LastData   DeviceData `json:"DeviceData"`
+	LastData   DeviceData `json:"lastData"`
 	MacAddress string     `json:"macAddress"`
 }
 
-// String is a helper function to print the AmbientDevice struct as a string.
+// Location is a public method that returns the name and location of the Device.
+func (d Device) Location() StationLocation {
+	return StationLocation{
+		Address:    d.Info.Coords.Address,
+		Elevation:  d.Info.Coords.Elevation,
+		Latitude:   d.Info.Coords.Coords.Lat,
+		Location:   d.Info.Coords.Location,
+		Longitude:  d.Info.Coords.Coords.Lon,
+		MacAddress: d.MacAddress,
+		Name:       d.Info.Name,
+	}
+}
+
+// LastReportTime is a public method that returns the time of the most recent reading of
+// the Device, from LastData.Date, or from LastData.Dateutc if the date is missing. It
+// returns the zero time if the weather station has never reported.
+func (d Device) LastReportTime() time.Time {
+	if !d.LastData.Date.IsZero() {
+		return d.LastData.Date
+	}
+
+	if d.LastData.Dateutc != 0 {
+		return time.UnixMilli(d.LastData.Dateutc).UTC()
+	}
+
+	return time.Time{}
+}
+
+// IsStale is a public method that reports whether the most recent reading of the Device
+// is older than threshold. A weather station that has never reported is always stale.
+func (d Device) IsStale(threshold time.Duration) bool {
+	last := d.LastReportTime()
+
+	return last.IsZero() || time.Since(last) > threshold
+}
+
+// AmbientDevice is used to marshal/unmarshal the response from the devices endpoint,
+// which is a list of every weather station that the API key has access to.
+type AmbientDevice []Device
+
+// Locations is a public method that returns the name and location of every weather
+// station in the AmbientDevice, in the same order.
+//
+// Basic Usage:
+//
+//	devices, err := awn.GetLatestData(ctx, funcData, url, version)
+//	for _, location := range devices.Locations() {
+//		fmt.Println(location.Name, location.Latitude, location.Longitude)
+//	}
+func (a AmbientDevice) Locations() []StationLocation {
+	locations := make([]StationLocation, len(a))
+	for i, device := range a {
+		locations[i] = device.Location()
+	}
+
+	return locations
+}
+
+// MacAddresses is a public method that returns the MAC address of every weather station
+// in the AmbientDevice, in the same order, ready to be passed to
+// GetHistoricalDataForDevices. Empty MAC addresses are skipped, and a weather station
+// that is listed more than once, such as when it is shared by two API keys, only shows up
+// once.
+//
+// Basic Usage:
+//
+//	devices, err := awn.GetLatestData(ctx, funcData, url, version)
+//	data, err := awn.GetHistoricalDataForDevices(ctx, funcData, url, version, devices.MacAddresses(), 4)
+func (a AmbientDevice) MacAddresses() []string {
+	macs := make([]string, 0, len(a))
+
+	for _, device := range a {
+		if device.MacAddress == "" || slices.Contains(macs, device.MacAddress) {
+			continue
+		}
+
+		macs = append(macs, device.MacAddress)
+	}
+
+	return macs
+}
+
+// LastReportTime is a public method that returns the time of the most recent reading
+// across every weather station in the AmbientDevice, or the zero time if none of them
+// has ever reported. Use Device.LastReportTime for a single weather station.
+func (a AmbientDevice) LastReportTime() time.Time {
+	var last time.Time
+
+	for _, device := range a {
+		if reported := device.LastReportTime(); reported.After(last) {
+			last = reported
+		}
+	}
+
+	return last
+}
+
+// IsStale is a public method that reports whether the most recent reading across every
+// weather station in the AmbientDevice is older than threshold, which means that none of
+// them is reporting. An AmbientDevice without any readings is always stale. Use
+// Device.IsStale to monitor each weather station on its own.
+//
+// Basic Usage:
+//
+//	devices, err := awn.GetLatestData(ctx, funcData, url, version)
+//	if devices.IsStale(30 * time.Minute) {
+//		// alert: the weather stations stopped reporting
+//	}
+func (a AmbientDevice) IsStale(threshold time.Duration) bool {
+	last := a.LastReportTime()
+
+	return last.IsZero() || time.Since(last) > threshold
+}
+
+// String is a helper function to print the AmbientDevice as a string.
 func (a AmbientDevice) String() string {
 	r, err := json.Marshal(a)
 	if err != nil {
-		log.Printf("unable to marshall json from AmbientDevice: %v", err)
+		getLogger().Error("unable to marshal json from AmbientDevice", "error", err)
 	}
 
 	return string(r)
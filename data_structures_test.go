@@ -2,7 +2,11 @@ package awn
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,8 +17,8 @@ func TestAmbientDeviceToString(t *testing.T) {
 		a    AmbientDevice
 		want string
 	}{
-		{"TestAmbientDeviceMacString", AmbientDevice{MacAddress: "00:11:22:33:44:55"}, `{"info":{"coords":{"address":"","coords":{"lat":0,"lon":0},"elevation":0,"geo":{"coordinates":null,"type":""},"location":""},"name":""},"DeviceData":{"baromabsin":0,"baromrelin":0,"batt_lightning":0,"dailyrainin":0,"date":"0001-01-01T00:00:00Z","dateutc":0,"dewPoint":0,"dewPointin":0,"eventrainin":0,"feelsLike":0,"feelsLikein":0,"hourlyrainin":0,"humidity":0,"humidityin":0,"lastRain":"0001-01-01T00:00:00Z","lightning_day":0,"lightning_distance":0,"lightning_hour":0,"lightning_time":0,"maxdailygust":0,"monthlyrainin":0,"solarradiation":0,"tempf":0,"tempinf":0,"tz":"","uv":0,"weeklyrainin":0,"winddir":0,"winddir_avg10m":0,"windgustmph":0,"windspdmph_avg10m":0,"windspeedmph":0,"yearlyrainin":0},"macAddress":"00:11:22:33:44:55"}`},
-		{name: "TestAmbientDeviceInfoString", a: AmbientDevice{Info: info{Coords: coords{Address: "123 Main", Location: "Anywhere, USA"}}}, want: `{"info":{"coords":{"address":"123 Main","coords":{"lat":0,"lon":0},"elevation":0,"geo":{"coordinates":null,"type":""},"location":"Anywhere, USA"},"name":""},"DeviceData":{"baromabsin":0,"baromrelin":0,"batt_lightning":0,"dailyrainin":0,"date":"0001-01-01T00:00:00Z","dateutc":0,"dewPoint":0,"dewPointin":0,"eventrainin":0,"feelsLike":0,"feelsLikein":0,"hourlyrainin":0,"humidity":0,"humidityin":0,"lastRain":"0001-01-01T00:00:00Z","lightning_day":0,"lightning_distance":0,"lightning_hour":0,"lightning_time":0,"maxdailygust":0,"monthlyrainin":0,"solarradiation":0,"tempf":0,"tempinf":0,"tz":"","uv":0,"weeklyrainin":0,"winddir":0,"winddir_avg10m":0,"windgustmph":0,"windspdmph_avg10m":0,"windspeedmph":0,"yearlyrainin":0},"macAddress":""}`},
+		{"TestAmbientDeviceMacString", AmbientDevice{{MacAddress: "00:11:22:33:44:55"}}, `[{"info":{"coords":{"address":"","coords":{"lat":0,"lon":0},"elevation":0,"geo":{"coordinates":null,"type":""},"location":""},"name":""},"lastData":{"baromabsin":0,"baromrelin":0,"batt_lightning":0,"dailyrainin":0,"date":"0001-01-01T00:00:00Z","dateutc":0,"dewPoint":0,"dewPointin":0,"eventrainin":0,"feelsLike":0,"feelsLikein":0,"hourlyrainin":0,"humidity":0,"humidityin":0,"lastRain":"0001-01-01T00:00:00Z","lightning_day":0,"lightning_distance":0,"lightning_hour":0,"lightning_time":0,"maxdailygust":0,"monthlyrainin":0,"solarradiation":0,"tempf":0,"tempinf":0,"tz":"","uv":0,"weeklyrainin":0,"winddir":0,"winddir_avg10m":0,"windgustmph":0,"windspdmph_avg10m":0,"windspeedmph":0,"yearlyrainin":0},"macAddress":"00:11:22:33:44:55"}]`},
+		{name: "TestAmbientDeviceInfoString", a: AmbientDevice{{Info: info{Coords: coords{Address: "123 Main", Location: "Anywhere, USA"}}}}, want: `[{"info":{"coords":{"address":"123 Main","coords":{"lat":0,"lon":0},"elevation":0,"geo":{"coordinates":null,"type":""},"location":"Anywhere, USA"},"name":""},"lastData":{"baromabsin":0,"baromrelin":0,"batt_lightning":0,"dailyrainin":0,"date":"0001-01-01T00:00:00Z","dateutc":0,"dewPoint":0,"dewPointin":0,"eventrainin":0,"feelsLike":0,"feelsLikein":0,"hourlyrainin":0,"humidity":0,"humidityin":0,"lastRain":"0001-01-01T00:00:00Z","lightning_day":0,"lightning_distance":0,"lightning_hour":0,"lightning_time":0,"maxdailygust":0,"monthlyrainin":0,"solarradiation":0,"tempf":0,"tempinf":0,"tz":"","uv":0,"weeklyrainin":0,"winddir":0,"winddir_avg10m":0,"windgustmph":0,"windspdmph_avg10m":0,"windspeedmph":0,"yearlyrainin":0},"macAddress":""}]`},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -26,8 +30,6 @@ func TestAmbientDeviceToString(t *testing.T) {
 }
 
 func TestDeviceDataResponseToString(t *testing.T) {
-	t.Skip("flaky test")
-
 	dateVar, _ := time.Parse(time.RFC3339, "2023-07-01T12:00:30Z")
 	lastRainVar, _ := time.Parse(time.RFC3339, "2023-10-12T04:53:00.000Z")
 
@@ -36,7 +38,7 @@ func TestDeviceDataResponseToString(t *testing.T) {
 		d    DeviceDataResponse
 		want string
 	}{
-		{name: "FullSuite", d: DeviceDataResponse{
+		{name: "FullSuite", d: DeviceDataResponse{{
 			Baromabsin: 29.675, Baromrelin: 29.775,
 			BattLightning: 0, Dailyrainin: 1.234,
 			Date: dateVar, Dateutc: 1697142300000,
@@ -53,7 +55,7 @@ func TestDeviceDataResponseToString(t *testing.T) {
 			Winddir: 239, WinddirAvg10M: 250,
 			Windgustmph: 5.6, WindspdmphAvg10M: 2.7,
 			Windspeedmph: 4.3, Yearlyrainin: 34.457,
-		}, want: `{"baromabsin":29.675,"baromrelin":29.775,"batt_lightning":0,"dailyrainin":1.234,"date":"2023-07-01T12:00:30Z","dateutc":1697142300000,"dewPoint":78.51,"dewPointin":78,"eventrainin":10.023,"feelsLike":99.2,"feelsLikein":0,"hourlyrainin":1.11,"humidity":79,"humidityin":76,"lastRain":"2023-10-12T04:53:00.000Z","lightning_day":1,"lightning_distance":4.97,"lightning_hour":53,"lightning_time":1696633175000,"maxdailygust":9.8,"monthlyrainin":5.925,"solarradiation":455.56,"tempf":85.8,"tempinf":5.24,"tz":"America","uv":4,"weeklyrainin":2.122,"winddir":239,"winddir_avg10m":250,"windgustmph":5.6,"windspdmph_avg10m":2.7,"windspeedmph":4.3,"yearlyrainin":34.457}`},
+		}}, want: `[{"baromabsin":29.675,"baromrelin":29.775,"batt_lightning":0,"dailyrainin":1.234,"date":"2023-07-01T12:00:30Z","dateutc":1697142300000,"dewPoint":78.51,"dewPointin":78,"eventrainin":10.023,"feelsLike":99.2,"feelsLikein":0,"hourlyrainin":1.11,"humidity":79,"humidityin":76,"lastRain":"2023-10-12T04:53:00Z","lightning_day":1,"lightning_distance":4.97,"lightning_hour":53,"lightning_time":1696633175000,"maxdailygust":9.8,"monthlyrainin":5.925,"solarradiation":455.56,"tempf":85.8,"tempinf":5.254,"tz":"America","uv":4,"weeklyrainin":2.122,"winddir":239,"winddir_avg10m":250,"windgustmph":5.6,"windspdmph_avg10m":2.7,"windspeedmph":4.3,"yearlyrainin":34.457}]`},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -61,6 +63,52 @@ func TestDeviceDataResponseToString(t *testing.T) {
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("TestDeviceDataResponseToString() = %v, want %v", got, tt.want)
 			}
+
+			var roundTrip DeviceDataResponse
+			if err := json.Unmarshal([]byte(got), &roundTrip); err != nil {
+				t.Fatalf("unable to unmarshal DeviceDataResponse: %v", err)
+			}
+			if !reflect.DeepEqual(roundTrip, tt.d) {
+				t.Errorf("round trip = %v, want %v", roundTrip, tt.d)
+			}
+		})
+	}
+}
+
+func TestWeatherRecordStringRoundTrip(t *testing.T) {
+	t.Parallel()
+	low := 0
+	tests := []struct {
+		name string
+		w    WeatherRecord
+		want string
+	}{
+		{"TestShortestFloats", WeatherRecord{Tempf: 0.1, Tempinf: 5.254, Baromrelin: 29.92},
+			`"baromrelin":29.92`},
+		{"TestTinyFloat", WeatherRecord{Hourlyrainin: 0.0000001}, `"hourlyrainin":1e-7`},
+		{"TestLargeFloat", WeatherRecord{Yearlyrainin: 123456789.123}, `"yearlyrainin":123456789.123`},
+		{"TestPointerField", WeatherRecord{Battout: &low}, `"battout":0`},
+		{"TestNilPointerField", WeatherRecord{Tempf: 70}, `"tempf":70`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := tt.w.String()
+			if got != tt.w.String() {
+				t.Errorf("String() is not deterministic")
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("String() = %v, want it to contain %v", got, tt.want)
+			}
+
+			var roundTrip WeatherRecord
+			if err := json.Unmarshal([]byte(got), &roundTrip); err != nil {
+				t.Fatalf("unable to unmarshal WeatherRecord: %v", err)
+			}
+			if !reflect.DeepEqual(roundTrip, tt.w) {
+				t.Errorf("round trip = %v, want %v", roundTrip, tt.w)
+			}
 		})
 	}
 }
@@ -186,6 +234,59 @@ func TestFunctionDataToMap(t *testing.T) {
 	}
 }
 
+func TestFunctionDataToMapKeys(t *testing.T) {
+	f := FunctionData{API: "api", App: "app", Epoch: 1234567890, Limit: 100, Mac: "00:11:22:33:44:55"}
+	want := map[string]interface{}{
+		"api":   "api",
+		"app":   "app",
+		"epoch": int64(1234567890),
+		"limit": 100,
+		"mac":   "00:11:22:33:44:55",
+	}
+
+	got := f.ToMap()
+	if len(got) != len(want) {
+		t.Errorf("FunctionDataToMap() has %v keys, want %v", len(got), len(want))
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("FunctionDataToMap()[%v] = %v (%T), want %v (%T)", key, got[key], got[key], value, value)
+		}
+	}
+}
+
+func TestFunctionDataValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		f           FunctionData
+		want        error
+		wantNoMacOk bool
+	}{
+		{"TestComplete", FunctionData{API: "api", App: "app", Mac: "00:11:22:33:44:55"}, nil, true},
+		{"TestMacMissing", FunctionData{API: "api", App: "app"}, ErrMacAddressMissing, true},
+		{"TestAppMissing", FunctionData{API: "api", Mac: "00:11:22:33:44:55"}, ErrAppKeyMissing, false},
+		{"TestAppAndMacMissing", FunctionData{API: "api"}, ErrAppKeyMissing, false},
+		{"TestAPIMissing", FunctionData{App: "app", Mac: "00:11:22:33:44:55"}, ErrAPIKeyMissing, false},
+		{"TestAPIAndMacMissing", FunctionData{App: "app"}, ErrAPIKeyMissing, false},
+		{"TestAPIAndAppMissing", FunctionData{Mac: "00:11:22:33:44:55"}, ErrAPIKeyMissing, false},
+		{"TestEverythingMissing", FunctionData{}, ErrAPIKeyMissing, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.f.Validate()
+			if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+			if err := tt.f.validateKeys(); (err == nil) != tt.wantNoMacOk {
+				t.Errorf("validateKeys() error = %v, want nil = %v", err, tt.wantNoMacOk)
+			}
+		})
+	}
+}
+
 func TestNewFunctionData(t *testing.T) {
 	f1 := FunctionData{API: "", App: "", Epoch: 0, Limit: 1, Mac: ""}
 
@@ -204,3 +305,381 @@ func TestNewFunctionData(t *testing.T) {
 		})
 	}
 }
+
+func TestFunctionDataBuilder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		builder *FunctionDataBuilder
+		want    FunctionData
+		wantErr error
+	}{
+		{"TestDefaults", NewFunctionDataBuilder().WithAPI("api").WithApp("app"),
+			FunctionData{API: "api", App: "app", Limit: 1}, nil},
+		{"TestEveryField", NewFunctionDataBuilder().WithAPI("api").WithAPIKeys("more").WithApp("app").
+			WithMac("00-11-22-AA-BB-CC").WithLimit(288).WithEpoch(1697142300000),
+			FunctionData{API: "api", APIKeys: []string{"more"}, App: "app", Epoch: 1697142300000, Limit: 288,
+				Mac: "00:11:22:aa:bb:cc"}, nil},
+		{"TestLastCallWins", NewFunctionDataBuilder().WithAPI("old").WithAPI("api").WithApp("app").WithLimit(5),
+			FunctionData{API: "api", App: "app", Limit: 5}, nil},
+		{"TestAPIMissing", NewFunctionDataBuilder().WithApp("app"), FunctionData{}, ErrAPIKeyMissing},
+		{"TestAppMissing", NewFunctionDataBuilder().WithAPI("api"), FunctionData{}, ErrAppKeyMissing},
+		{"TestLimitTooLow", NewFunctionDataBuilder().WithAPI("api").WithApp("app").WithLimit(0), FunctionData{},
+			ErrInvalidLimit},
+		{"TestLimitTooHigh", NewFunctionDataBuilder().WithAPI("api").WithApp("app").WithLimit(289),
+			FunctionData{}, ErrInvalidLimit},
+		{"TestMalformedMac", NewFunctionDataBuilder().WithAPI("api").WithApp("app").WithMac("00:11"),
+			FunctionData{}, ErrMalformedMacAddress},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.builder.Build()
+			if !reflect.DeepEqual(got, tt.want) || !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("Build() = %+v, %v, want %+v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAmbientDeviceLocations(t *testing.T) {
+	t.Parallel()
+	payload := `[
+		{
+			"macAddress": "00:11:22:33:44:55",
+			"lastData": {"dateutc": 1697142300000, "tempf": 85.8, "humidity": 79},
+			"info": {
+				"name": "Backyard",
+				"coords": {
+					"coords": {"lat": 41.8781, "lon": -87.6298},
+					"address": "233 S Wacker Dr, Chicago, IL 60606, USA",
+					"location": "Chicago",
+					"elevation": 181.4,
+					"geo": {"type": "Point", "coordinates": [-87.6298, 41.8781]}
+				}
+			}
+		},
+		{
+			"macAddress": "66:77:88:99:AA:BB",
+			"lastData": {"dateutc": 1697142300000, "tempf": 61.2},
+			"info": {"name": "Cabin"}
+		}
+	]`
+
+	var devices AmbientDevice
+	if err := json.Unmarshal([]byte(payload), &devices); err != nil {
+		t.Fatalf("unable to unmarshal devices: %v", err)
+	}
+
+	want := []StationLocation{
+		{
+			Address: "233 S Wacker Dr, Chicago, IL 60606, USA", Elevation: 181.4, Latitude: 41.8781,
+			Location: "Chicago", Longitude: -87.6298, MacAddress: "00:11:22:33:44:55", Name: "Backyard",
+		},
+		{MacAddress: "66:77:88:99:AA:BB", Name: "Cabin"},
+	}
+	if got := devices.Locations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Locations() = %v, want %v", got, want)
+	}
+
+	if devices[0].LastData.Tempf != 85.8 {
+		t.Errorf("LastData.Tempf = %v, want 85.8", devices[0].LastData.Tempf)
+	}
+}
+
+func TestAmbientDeviceMacAddresses(t *testing.T) {
+	t.Parallel()
+	payload := `[
+		{"macAddress": "00:11:22:33:44:55", "info": {"name": "Backyard"}},
+		{"macAddress": "", "info": {"name": "Unnamed"}},
+		{"macAddress": "66:77:88:99:AA:BB", "info": {"name": "Cabin"}},
+		{"macAddress": "00:11:22:33:44:55", "info": {"name": "Backyard"}},
+		{"info": {"name": "Missing"}}
+	]`
+
+	var devices AmbientDevice
+	if err := json.Unmarshal([]byte(payload), &devices); err != nil {
+		t.Fatalf("unable to unmarshal devices: %v", err)
+	}
+
+	want := []string{"00:11:22:33:44:55", "66:77:88:99:AA:BB"}
+	if got := devices.MacAddresses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("MacAddresses() = %v, want %v", got, want)
+	}
+
+	if got := (AmbientDevice{}).MacAddresses(); len(got) != 0 {
+		t.Errorf("MacAddresses() = %v, want none", got)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		data []DeviceDataResponse
+		want []WeatherRecord
+	}{
+		{"TestPagesInOrder", []DeviceDataResponse{
+			{{Dateutc: 6}, {Dateutc: 5}},
+			{{Dateutc: 4}},
+			{},
+			{{Dateutc: 3}, {Dateutc: 2}, {Dateutc: 1}},
+		}, []WeatherRecord{{Dateutc: 6}, {Dateutc: 5}, {Dateutc: 4}, {Dateutc: 3}, {Dateutc: 2}, {Dateutc: 1}}},
+		{"TestEmptyPages", []DeviceDataResponse{{}, {}}, []WeatherRecord{}},
+		{"TestNil", nil, []WeatherRecord{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := Flatten(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Flatten() returned %v records, want %v", len(got), len(tt.want))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Flatten() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceDataResponseLatest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		data   DeviceDataResponse
+		want   WeatherRecord
+		wantOk bool
+	}{
+		{"TestNewestFirst", DeviceDataResponse{{Dateutc: 3, Tempf: 70}, {Dateutc: 2}, {Dateutc: 1}},
+			WeatherRecord{Dateutc: 3, Tempf: 70}, true},
+		{"TestShuffled", DeviceDataResponse{{Dateutc: 2}, {Dateutc: 5, Tempf: 71}, {Dateutc: 1}, {Dateutc: 4}},
+			WeatherRecord{Dateutc: 5, Tempf: 71}, true},
+		{"TestOldestFirst", DeviceDataResponse{{Dateutc: 1}, {Dateutc: 2}, {Dateutc: 3, Tempf: 72}},
+			WeatherRecord{Dateutc: 3, Tempf: 72}, true},
+		{"TestEmpty", DeviceDataResponse{}, WeatherRecord{}, false},
+		{"TestNil", nil, WeatherRecord{}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := tt.data.Latest()
+			if ok != tt.wantOk || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Latest() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestWeatherRecordEqual(t *testing.T) {
+	t.Parallel()
+	low := 0
+	base := WeatherRecord{Dateutc: 1697142300000, Tempf: 85.8, Humidity: 79, Winddir: 239}
+
+	tests := []struct {
+		name  string
+		other WeatherRecord
+		want  bool
+	}{
+		{"TestIdentical", base, true},
+		{"TestOnlyUncomparedFieldsDiffer", WeatherRecord{Dateutc: 1697142300000, Tempf: 85.8, Humidity: 79,
+			Winddir: 239, Tz: "America/Chicago", Battout: &low}, true},
+		{"TestDifferentTime", WeatherRecord{Dateutc: 1697142000000, Tempf: 85.8, Humidity: 79, Winddir: 239}, false},
+		{"TestNearDuplicate", WeatherRecord{Dateutc: 1697142300000, Tempf: 85.9, Humidity: 79, Winddir: 239}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := base.Equal(tt.other); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+			if got := tt.other.Equal(base); got != tt.want {
+				t.Errorf("Equal() reversed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherRecordLocalDate(t *testing.T) {
+	t.Parallel()
+	// daylight saving time ended in Chicago at 07:00 UTC on 2023-11-05, so 01:30 came twice
+	beforeDST := time.Date(2023, 11, 5, 6, 30, 0, 0, time.UTC)
+	afterDST := time.Date(2023, 11, 5, 7, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		record     WeatherRecord
+		wantClock  string
+		wantOffset int
+		wantErr    error
+	}{
+		{"TestKnownTimezone", WeatherRecord{Date: time.Date(2023, 10, 12, 20, 25, 0, 0, time.UTC),
+			Tz: "America/Chicago"}, "15:25", -5 * 3600, nil},
+		{"TestBeforeDSTEnds", WeatherRecord{Date: beforeDST, Tz: "America/Chicago"}, "01:30", -5 * 3600, nil},
+		{"TestAfterDSTEnds", WeatherRecord{Date: afterDST, Tz: "America/Chicago"}, "01:30", -6 * 3600, nil},
+		{"TestFromDateutc", WeatherRecord{Dateutc: afterDST.UnixMilli(), Tz: "America/Chicago"}, "01:30", -6 * 3600,
+			nil},
+		{"TestEmptyTimezone", WeatherRecord{Date: beforeDST}, "", 0, ErrUnknownTimezone},
+		{"TestUnknownTimezone", WeatherRecord{Date: beforeDST, Tz: "America/Atlantis"}, "", 0, ErrUnknownTimezone},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.record.LocalDate()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !got.IsZero() {
+					t.Errorf("LocalDate() = %v, %v, want %v", got, err, tt.wantErr)
+				}
+				if want := fmt.Sprintf("unknown: %q", tt.record.Tz); tt.record.Tz != "" &&
+					!strings.Contains(err.Error(), want) {
+					t.Errorf("LocalDate() error = %q, want it to name the time zone after %q", err, want)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("LocalDate() error = %v", err)
+			}
+			if _, offset := got.Zone(); got.Format("15:04") != tt.wantClock || offset != tt.wantOffset {
+				t.Errorf("LocalDate() = %v, want %v at offset %v", got, tt.wantClock, tt.wantOffset)
+			}
+			if !got.Equal(time.UnixMilli(tt.record.Dateutc)) && !got.Equal(tt.record.Date) {
+				t.Errorf("LocalDate() = %v, which is not the same instant as the record", got)
+			}
+		})
+	}
+}
+
+func TestWeatherRecordLightning(t *testing.T) {
+	t.Parallel()
+	recent := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+	old := time.Now().Add(-3 * time.Hour).Truncate(time.Millisecond)
+
+	tests := []struct {
+		name       string
+		record     WeatherRecord
+		wantTime   time.Time
+		wantRecent bool
+	}{
+		{"TestRecentStrike", WeatherRecord{LightningTime: recent.UnixMilli(), LightningDistance: 4.2}, recent, true},
+		{"TestOldStrike", WeatherRecord{LightningTime: old.UnixMilli(), LightningDistance: 12.5}, old, false},
+		{"TestNoStrike", WeatherRecord{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := tt.record.LastLightningTime()
+			if !got.Equal(tt.wantTime) || (!got.IsZero() && got.Location() != time.UTC) {
+				t.Errorf("LastLightningTime() = %v, want %v in UTC", got, tt.wantTime)
+			}
+			if got := tt.record.HasRecentLightning(30 * time.Minute); got != tt.wantRecent {
+				t.Errorf("HasRecentLightning() = %v, want %v", got, tt.wantRecent)
+			}
+		})
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		records []WeatherRecord
+		want    []WeatherRecord
+	}{
+		{"TestOverlappingWindows", []WeatherRecord{{Dateutc: 3}, {Dateutc: 2}, {Dateutc: 2}, {Dateutc: 1}},
+			[]WeatherRecord{{Dateutc: 3}, {Dateutc: 2}, {Dateutc: 1}}},
+		{"TestNearDuplicateKeepsFirst", []WeatherRecord{{Dateutc: 2, Tempf: 70}, {Dateutc: 2, Tempf: 71}},
+			[]WeatherRecord{{Dateutc: 2, Tempf: 70}}},
+		{"TestNoDuplicates", []WeatherRecord{{Dateutc: 1}, {Dateutc: 3}, {Dateutc: 2}},
+			[]WeatherRecord{{Dateutc: 1}, {Dateutc: 3}, {Dateutc: 2}}},
+		{"TestEmpty", nil, []WeatherRecord{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := Dedupe(tt.records); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dedupe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeRecords(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		series [][]WeatherRecord
+		want   []WeatherRecord
+	}{
+		{"TestTwoOverlapping", [][]WeatherRecord{
+			{{Dateutc: 1}, {Dateutc: 3}, {Dateutc: 5, Tempf: 70}},
+			{{Dateutc: 2}, {Dateutc: 5, Tempf: 71}, {Dateutc: 6}},
+		}, []WeatherRecord{{Dateutc: 1}, {Dateutc: 2}, {Dateutc: 3}, {Dateutc: 5, Tempf: 70}, {Dateutc: 6}}},
+		{"TestThreeOverlapping", [][]WeatherRecord{
+			{{Dateutc: 4}, {Dateutc: 5}, {Dateutc: 6}},
+			{{Dateutc: 1}, {Dateutc: 2}, {Dateutc: 4}},
+			{{Dateutc: 2}, {Dateutc: 3}, {Dateutc: 7}},
+		}, []WeatherRecord{
+			{Dateutc: 1}, {Dateutc: 2}, {Dateutc: 3}, {Dateutc: 4}, {Dateutc: 5}, {Dateutc: 6}, {Dateutc: 7},
+		}},
+		{"TestDuplicateWithinSeries", [][]WeatherRecord{{{Dateutc: 1}, {Dateutc: 1}, {Dateutc: 2}}},
+			[]WeatherRecord{{Dateutc: 1}, {Dateutc: 2}}},
+		{"TestEmptySeries", [][]WeatherRecord{nil, {{Dateutc: 1}}, {}}, []WeatherRecord{{Dateutc: 1}}},
+		{"TestNoSeries", nil, []WeatherRecord{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := MergeRecords(tt.series...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeRecords() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmbientDeviceIsStale(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	fresh := Device{MacAddress: "fresh", LastData: DeviceData{Date: now.Add(-5 * time.Minute)}}
+	stale := Device{MacAddress: "stale", LastData: DeviceData{Date: now.Add(-3 * time.Hour)}}
+	dateutcOnly := Device{MacAddress: "dateutc", LastData: DeviceData{Dateutc: now.Add(-10 * time.Minute).UnixMilli()}}
+	never := Device{MacAddress: "never"}
+
+	tests := []struct {
+		name      string
+		a         AmbientDevice
+		wantLast  time.Time
+		wantStale bool
+	}{
+		{"TestFresh", AmbientDevice{fresh}, fresh.LastData.Date, false},
+		{"TestStale", AmbientDevice{stale}, stale.LastData.Date, true},
+		{"TestNewestWins", AmbientDevice{stale, fresh, never}, fresh.LastData.Date, false},
+		{"TestDateutcOnly", AmbientDevice{dateutcOnly}, now.Add(-10 * time.Minute), false},
+		{"TestNeverReported", AmbientDevice{never}, time.Time{}, true},
+		{"TestEmpty", AmbientDevice{}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.a.LastReportTime(); !got.Equal(tt.wantLast) {
+				t.Errorf("LastReportTime() = %v, want %v", got, tt.wantLast)
+			}
+			if got := tt.a.IsStale(time.Hour); got != tt.wantStale {
+				t.Errorf("IsStale() = %v, want %v", got, tt.wantStale)
+			}
+		})
+	}
+
+	if !stale.IsStale(time.Hour) || fresh.IsStale(time.Hour) || !never.IsStale(time.Hour) {
+		t.Errorf("Device.IsStale() = %v, %v, %v, want true, false, true",
+			stale.IsStale(time.Hour), fresh.IsStale(time.Hour), never.IsStale(time.Hour))
+	}
+}
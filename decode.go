@@ -0,0 +1,408 @@
+package awn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wholeNumberPrecision is the precision, in bits, that parseWholeNumber parses numbers
+// with. It is well above the 64 bits of an int64, so that no digit is lost to rounding.
+const wholeNumberPrecision = 128
+
+// decodeDeviceData is a private function that decodes the body of a response from the
+// devices/macAddress endpoint into a DeviceDataResponse, honoring any decoding related
+// options set by the caller.
+func decodeDeviceData(body []byte, options fetchOptions) (DeviceDataResponse, error) {
+	if len(options.fields) > 0 {
+		deviceData, err := decodeFields(body, options.fields, options.unmarshal)
+		if err != nil {
+			return nil, partialResponse(body, err)
+		}
+
+		return deviceData, nil
+	}
+
+	var deviceData DeviceDataResponse
+
+	err := options.unmarshal(body, &deviceData)
+	if err != nil {
+		return nil, partialResponse(body, fmt.Errorf("unable to unmarshal device data: %w", err))
+	}
+
+	return deviceData, nil
+}
+
+// partialResponse is a private helper function that turns an error from decoding body
+// into ErrPartialResponse when body is not valid JSON, which is what is left when the
+// connection drops before the whole response is read. The error carries the byte offset
+// at which decoding failed and wraps the original error. Any other error is returned
+// as-is.
+func partialResponse(body []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return ErrPartialResponse.from(int(syntaxErr.Offset), err).
+			withDetail("decoding failed at byte %v", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrPartialResponse.from(len(body), err).withDetail("decoding failed at byte %v", len(body))
+	default:
+		return err
+	}
+}
+
+// weatherRecordFields is a private helper function that returns a map of the JSON names
+// of the WeatherRecord fields to their index in the struct.
+func weatherRecordFields() map[string]int {
+	recordType := reflect.TypeOf(WeatherRecord{}) //nolint:exhaustruct
+	fields := make(map[string]int, recordType.NumField())
+
+	for i := 0; i < recordType.NumField(); i++ {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+		fields[name] = i
+	}
+
+	return fields
+}
+
+// projectionIndexes is a private helper function that returns a map of each of the given
+// JSON names to the index of its WeatherRecord field. It returns ErrUnknownField if a
+// name is not a WeatherRecord field, or if there are none.
+func projectionIndexes(fields []string) (map[string]int, error) {
+	if len(fields) == 0 {
+		return nil, ErrUnknownField.withDetail("no fields were given")
+	}
+
+	known := weatherRecordFields()
+	indexes := make(map[string]int, len(fields))
+
+	for _, field := range fields {
+		index, ok := known[field]
+		if !ok {
+			return nil, ErrUnknownField.withDetail("%q", field)
+		}
+
+		indexes[field] = index
+	}
+
+	return indexes, nil
+}
+
+// projectRecord is a private helper function that returns a map of the fields of record
+// in indexes to their values. Optional fields that are nil are left out.
+func projectRecord(record WeatherRecord, indexes map[string]int) map[string]any {
+	value := reflect.ValueOf(record)
+	projected := make(map[string]any, len(indexes))
+
+	for name, index := range indexes {
+		field := value.Field(index)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+
+			field = field.Elem()
+		}
+
+		projected[name] = field.Interface()
+	}
+
+	return projected
+}
+
+// ValidateSchema is a public function that checks a raw response from the
+// devices/macAddress endpoint, or a single record of it, against WeatherRecord. It
+// returns ErrSchemaMismatch, with the number of fields and their names, if the response
+// has fields that WeatherRecord does not, which would otherwise be dropped without a
+// word when decoding. This is how a new sensor or a renamed field shows up. Unlike a
+// json.Decoder with DisallowUnknownFields, which stops at the first one, every unknown
+// field is reported. The data functions never call it, so they stay lenient. Pair it with
+// WithRawBody to check live responses.
+//
+// Basic Usage:
+//
+//	err := awn.ValidateSchema(body)
+//	if errors.Is(err, awn.ErrSchemaMismatch) {
+//		log.Printf("the api has new fields: %v", err)
+//	}
+func ValidateSchema(raw []byte) error {
+	var records []map[string]json.RawMessage
+
+	trimmed := bytes.TrimSpace(raw)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		records = make([]map[string]json.RawMessage, 1)
+		err := json.Unmarshal(trimmed, &records[0])
+		if err != nil {
+			return partialResponse(raw, fmt.Errorf("unable to unmarshal weather record: %w", err))
+		}
+	} else {
+		err := json.Unmarshal(trimmed, &records)
+		if err != nil {
+			return partialResponse(raw, fmt.Errorf("unable to unmarshal device data: %w", err))
+		}
+	}
+
+	known := weatherRecordFields()
+	var unknown []string
+
+	for _, record := range records {
+		for name := range record {
+			if _, ok := known[name]; !ok && !slices.Contains(unknown, name) {
+				unknown = append(unknown, name)
+			}
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	slices.Sort(unknown)
+
+	noun := "fields"
+	if len(unknown) == 1 {
+		noun = "field"
+	}
+
+	return ErrSchemaMismatch.withDetail("%v %v: %v", len(unknown), noun, strings.Join(unknown, ", "))
+}
+
+// decodeFields is a private function that decodes a JSON array of weather records, but
+// only keeps the values of the requested fields. It does this by building a struct type
+// at runtime that only contains the requested fields, which lets encoding/json skip over
+// every other value without converting it, and then copying the values into
+// WeatherRecord objects. It returns an error if one of the requested fields is not a
+// WeatherRecord field.
+func decodeFields(body []byte, fields []string, unmarshal UnmarshalFunc) (DeviceDataResponse, error) {
+	known := weatherRecordFields()
+	recordType := reflect.TypeOf(WeatherRecord{}) //nolint:exhaustruct
+	indexes := make([]int, 0, len(fields))
+	structFields := make([]reflect.StructField, 0, len(fields))
+
+	for _, field := range fields {
+		index, ok := known[field]
+		if !ok {
+			return nil, ErrUnknownField.withDetail("%q", field)
+		}
+
+		if slices.Contains(indexes, index) {
+			continue
+		}
+
+		indexes = append(indexes, index)
+		structFields = append(structFields, recordType.Field(index))
+	}
+
+	projected := reflect.New(reflect.SliceOf(reflect.StructOf(structFields)))
+
+	err := unmarshal(body, projected.Interface())
+	if err != nil {
+		// the projected type does not have the lenient UnmarshalJSON of WeatherRecord, so
+		// retry with it before giving up
+		return decodeFieldsLeniently(body, indexes, unmarshal)
+	}
+
+	projected = projected.Elem()
+	deviceData := make(DeviceDataResponse, projected.Len())
+
+	for i := range deviceData {
+		record := reflect.ValueOf(&deviceData[i]).Elem()
+		for j, index := range indexes {
+			record.Field(index).Set(projected.Index(i).Field(j))
+		}
+	}
+
+	return deviceData, nil
+}
+
+// decodeFieldsLeniently is a private function that decodes every field of each weather
+// record with the lenient WeatherRecord.UnmarshalJSON, then only keeps the fields at
+// the given indexes. It is the slow path of decodeFields.
+func decodeFieldsLeniently(body []byte, indexes []int, unmarshal UnmarshalFunc) (DeviceDataResponse, error) {
+	var full DeviceDataResponse
+
+	err := unmarshal(body, &full)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal device data: %w", err)
+	}
+
+	deviceData := make(DeviceDataResponse, len(full))
+
+	for i := range deviceData {
+		record := reflect.ValueOf(&deviceData[i]).Elem()
+		for _, index := range indexes {
+			record.Field(index).Set(reflect.ValueOf(full[i]).Field(index))
+		}
+	}
+
+	return deviceData, nil
+}
+
+// UnmarshalJSON is a public method that decodes a single weather record. The Ambient
+// Weather API is not consistent between stations: some send numeric values, such as
+// winddir, as quoted strings, or write a whole number as a decimal, and some firmware
+// sends dates as an epoch time in milliseconds instead of an RFC 3339 string. When the
+// record cannot be decoded as-is, numeric fields that arrive as strings are converted to
+// numbers, whole numbers written as decimals are accepted for whole-number fields,
+// values that are not numbers at all (i.e. "N/A" or "") or that have a fractional part
+// where a whole number is expected are treated as missing and epoch dates are converted
+// to a time.Time in UTC, so a single odd station does not fail a whole batch. Missing
+// fields are left at their zero value.
+func (w *WeatherRecord) UnmarshalJSON(data []byte) error {
+	// plain has the same fields as WeatherRecord, but not this method
+	type plain WeatherRecord
+
+	var record plain
+
+	err := json.Unmarshal(data, &record)
+	if err == nil {
+		*w = WeatherRecord(record)
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal weather record: %w", err)
+	}
+
+	coerceFields(fields)
+
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal weather record: %w", err)
+	}
+
+	record = plain{} //nolint:exhaustruct
+
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal weather record: %w", err)
+	}
+
+	*w = WeatherRecord(record)
+
+	return nil
+}
+
+// coerceFields is a private helper function that rewrites the raw values of the
+// WeatherRecord fields in place so that they can be decoded: quoted numbers are
+// unquoted, whole numbers written as decimals are rewritten as integers for whole-number
+// fields and anything that is not a number, or not a whole number where one is expected,
+// is removed. Dates that are sent as an epoch time in milliseconds are converted
+// to RFC 3339.
+func coerceFields(fields map[string]json.RawMessage) {
+	recordType := reflect.TypeOf(WeatherRecord{}) //nolint:exhaustruct
+	timeType := reflect.TypeOf(time.Time{})       //nolint:exhaustruct
+
+	for name, index := range weatherRecordFields() {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		fieldType := recordType.Field(index).Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if fieldType == timeType {
+			fields[name] = coerceDate(raw)
+			continue
+		}
+
+		kind := fieldType.Kind()
+		if kind != reflect.Float64 && kind != reflect.Int && kind != reflect.Int64 {
+			continue
+		}
+
+		raw = bytes.TrimSpace(raw)
+		if bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+
+		text := string(raw)
+		if unquoted, err := strconv.Unquote(text); err == nil {
+			text = strings.TrimSpace(unquoted)
+		}
+
+		if kind != reflect.Float64 {
+			value, err := parseWholeNumber(text)
+			if err != nil {
+				getLogger().Warn("ignoring value that is not a whole number", "field", name, "value", string(raw),
+					"error", err)
+				delete(fields, name)
+				continue
+			}
+
+			fields[name] = json.RawMessage(strconv.FormatInt(value, 10))
+			continue
+		}
+
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			getLogger().Warn("ignoring non-numeric value", "field", name, "value", string(raw))
+			delete(fields, name)
+			continue
+		}
+
+		fields[name] = json.RawMessage(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+}
+
+// parseWholeNumber is a private helper function that parses text as a whole number
+// without going through a float64, so that large values, such as epoch times in
+// milliseconds, keep every digit. Whole numbers that are written as decimals or in
+// scientific notation (i.e. 1.6971423e12) are accepted. It returns an error if text is
+// not a number, has a fractional part (i.e. 1697142300000.7) or does not fit in an int64,
+// rather than guessing which way to round it.
+func parseWholeNumber(text string) (int64, error) {
+	value, err := json.Number(text).Int64()
+	if err == nil {
+		return value, nil
+	}
+
+	number, _, err := big.ParseFloat(text, 10, wholeNumberPrecision, big.ToNearestEven)
+	if err != nil {
+		return 0, fmt.Errorf("not a number: %q", text)
+	}
+
+	if !number.IsInt() {
+		return 0, fmt.Errorf("not a whole number: %q", text)
+	}
+
+	whole, _ := number.Int(nil)
+	if !whole.IsInt64() {
+		return 0, fmt.Errorf("number does not fit in an int64: %q", text)
+	}
+
+	return whole.Int64(), nil
+}
+
+// coerceDate is a private helper function that converts the raw value of a date field to
+// a quoted RFC 3339 string if it is an epoch time in milliseconds, either as a number or
+// a quoted number, including in scientific notation. Any other value is returned
+// unchanged.
+func coerceDate(raw json.RawMessage) json.RawMessage {
+	text := string(bytes.TrimSpace(raw))
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	epoch, err := parseWholeNumber(text)
+	if err != nil {
+		return raw
+	}
+
+	return json.RawMessage(strconv.Quote(time.UnixMilli(epoch).UTC().Format(time.RFC3339Nano)))
+}
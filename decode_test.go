@@ -0,0 +1,436 @@
+package awn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const twoRecordPayload = `[
+	{"dateutc":1697142300000,"tempf":85.8,"humidity":79,"winddir":239,"tz":"America/Chicago","date":"2023-10-12T20:25:00.000Z"},
+	{"dateutc":1697142000000,"tempf":85.1,"humidity":80,"winddir":241,"tz":"America/Chicago","date":"2023-10-12T20:20:00.000Z"}
+]`
+
+func TestDecodeFields(t *testing.T) {
+	t.Parallel()
+	got, err := decodeFields([]byte(twoRecordPayload), []string{"tempf", "dateutc", "tempf"}, json.Unmarshal)
+	if err != nil {
+		t.Fatalf("decodeFields() error = %v", err)
+	}
+
+	want := DeviceDataResponse{
+		{Dateutc: 1697142300000, Tempf: 85.8},
+		{Dateutc: 1697142000000, Tempf: 85.1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("decodeFields() returned %v records, want %v", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("decodeFields()[%v] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeFieldsUnknownField(t *testing.T) {
+	t.Parallel()
+	_, err := decodeFields([]byte(twoRecordPayload), []string{"tempf", "notAField"}, json.Unmarshal)
+	if !errors.Is(err, ErrUnknownField) {
+		t.Errorf("decodeFields() error = %v, want %v", err, ErrUnknownField)
+	}
+}
+
+func TestProjectionIndexesErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		fields  []string
+		wantMsg string
+	}{
+		{"TestUnknownField", []string{"tempf", "tempc"}, `unknown or unsupported weather record field: "tempc"`},
+		{"TestNoFields", nil, "unknown or unsupported weather record field: no fields were given"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := projectionIndexes(tt.fields)
+			if !errors.Is(err, ErrUnknownField) {
+				t.Fatalf("projectionIndexes() error = %v, want %v", err, ErrUnknownField)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("projectionIndexes() error = %q, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+		wantMsg string
+	}{
+		{"TestKnownFields", twoRecordPayload, nil, ""},
+		{"TestEmpty", `[]`, nil, ""},
+		{"TestUnknownFields", `[
+			{"dateutc":1697142300000,"tempf":85.8,"pm10_in":4,"leafwetness1":7},
+			{"dateutc":1697142000000,"tempf":85.1,"pm10_in":5}
+		]`, ErrSchemaMismatch,
+			"response has fields that WeatherRecord does not know about: 2 fields: leafwetness1, pm10_in"},
+		{"TestSingleRecord", `{"dateutc":1697142300000,"tempf":85.8,"pm10_in":4}`, ErrSchemaMismatch,
+			"response has fields that WeatherRecord does not know about: 1 field: pm10_in"},
+		{"TestTruncated", `[{"dateutc":1697142300000,"tem`, ErrPartialResponse, ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateSchema([]byte(tt.raw))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("ValidateSchema() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateSchema() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantMsg != "" && err.Error() != tt.wantMsg {
+				t.Errorf("ValidateSchema() error message = %q, want %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestDecodeDeviceDataAllFields(t *testing.T) {
+	t.Parallel()
+	got, err := decodeDeviceData([]byte(twoRecordPayload), newFetchOptions(nil))
+	if err != nil {
+		t.Fatalf("decodeDeviceData() error = %v", err)
+	}
+
+	date, _ := time.Parse(time.RFC3339, "2023-10-12T20:25:00.000Z")
+	want := WeatherRecord{
+		Dateutc: 1697142300000, Tempf: 85.8, Humidity: 79, Winddir: 239, Tz: "America/Chicago", Date: date,
+	}
+	if got[0] != want {
+		t.Errorf("decodeDeviceData()[0] = %v, want %v", got[0], want)
+	}
+}
+
+func TestWithDecoder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		fields []string
+	}{
+		{"TestAllFields", nil},
+		{"TestWithFields", []string{"tempf"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			calls := 0
+			counting := func(data []byte, v any) error {
+				calls++
+				return json.Unmarshal(data, v)
+			}
+
+			options := newFetchOptions([]Option{WithFields(tt.fields), WithDecoder(counting)})
+
+			got, err := decodeDeviceData([]byte(twoRecordPayload), options)
+			if err != nil {
+				t.Fatalf("decodeDeviceData() error = %v", err)
+			}
+			if calls != 1 {
+				t.Errorf("injected decoder was called %v times, want 1", calls)
+			}
+			if len(got) != 2 || got[0].Tempf != 85.8 {
+				t.Errorf("decodeDeviceData() = %v, want the two records", got)
+			}
+		})
+	}
+}
+
+func TestWithDecoderError(t *testing.T) {
+	t.Parallel()
+	failing := func([]byte, any) error { return errors.New("decoder failed") }
+
+	_, err := decodeDeviceData([]byte(twoRecordPayload), newFetchOptions([]Option{WithDecoder(failing)}))
+	if err == nil {
+		t.Errorf("decodeDeviceData() error = %v, want the decoder error", err)
+	}
+
+	// a nil decoder keeps the default
+	if _, err := decodeDeviceData([]byte(twoRecordPayload), newFetchOptions([]Option{WithDecoder(nil)})); err != nil {
+		t.Errorf("decodeDeviceData() error = %v, want nil", err)
+	}
+}
+
+// benchmarkPayload is a helper function that builds a devices/macAddress response with
+// n fully populated records.
+func benchmarkPayload(b *testing.B, n int) []byte {
+	b.Helper()
+
+	record := WeatherRecord{
+		Baromabsin: 29.675, Baromrelin: 29.775, Dailyrainin: 1.234, Dateutc: 1697142300000,
+		DewPoint: 78.51, DewPointin: 78, FeelsLike: 99.2, Humidity: 79, Humidityin: 76,
+		Maxdailygust: 9.8, Monthlyrainin: 5.925, Solarradiation: 455.56, Tempf: 85.8,
+		Tempinf: 75.2, Tz: "America/Chicago", Uv: 4, Weeklyrainin: 2.122, Winddir: 239,
+		Windgustmph: 5.6, Windspeedmph: 4.3, Yearlyrainin: 34.457,
+	}
+
+	records := make(DeviceDataResponse, n)
+	for i := range records {
+		records[i] = record
+	}
+
+	payload, err := json.Marshal(records)
+	if err != nil {
+		b.Fatalf("unable to marshal payload: %v", err)
+	}
+
+	return payload
+}
+
+func BenchmarkDecodeDeviceData(b *testing.B) {
+	payload := benchmarkPayload(b, 288)
+
+	for _, fields := range [][]string{nil, {"tempf"}, {"tempf", "humidity", "dateutc"}} {
+		options := newFetchOptions([]Option{WithFields(fields)})
+		name := "AllFields"
+		if len(fields) > 0 {
+			name = fmt.Sprintf("Fields[%v]", strings.Join(fields, ","))
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := decodeDeviceData(payload, options)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecoders(b *testing.B) {
+	payload := benchmarkPayload(b, 288)
+
+	// add a third-party UnmarshalFunc here (i.e. jsoniter.ConfigFastest.Unmarshal) to
+	// see how it compares on your machine
+	decoders := []struct {
+		name      string
+		unmarshal UnmarshalFunc
+	}{
+		{"Unmarshal", json.Unmarshal},
+		{"Decoder", func(data []byte, v any) error {
+			return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+		}},
+	}
+	for _, decoder := range decoders {
+		options := newFetchOptions([]Option{WithDecoder(decoder.unmarshal)})
+
+		b.Run(decoder.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := decodeDeviceData(payload, options)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherRecordUnmarshalJSON(t *testing.T) {
+	t.Parallel()
+	ok := 1
+	tests := []struct {
+		name    string
+		payload string
+		want    WeatherRecord
+	}{
+		{"TestNumbers", `{"dateutc":1697142300000,"winddir":239,"tempf":85.8}`,
+			WeatherRecord{Dateutc: 1697142300000, Winddir: 239, Tempf: 85.8}},
+		{"TestQuotedNumbers", `{"dateutc":"1697142300000","winddir":"239","tempf":"85.8"}`,
+			WeatherRecord{Dateutc: 1697142300000, Winddir: 239, Tempf: 85.8}},
+		{"TestQuotedNumberWithSpaces", `{"winddir":" 239 ","tz":"America/Chicago"}`,
+			WeatherRecord{Winddir: 239, Tz: "America/Chicago"}},
+		{"TestDecimalForWholeNumber", `{"winddir":239.0,"humidity":"79.00"}`,
+			WeatherRecord{Winddir: 239, Humidity: 79}},
+		{"TestNotANumber", `{"winddir":"N/A","tempf":"","humidity":79}`,
+			WeatherRecord{Humidity: 79}},
+		{"TestQuotedPointerField", `{"battout":"1","tempf":"70"}`,
+			WeatherRecord{Battout: &ok, Tempf: 70}},
+		{"TestMissingFields", `{"tempf":70}`, WeatherRecord{Tempf: 70}},
+		{"TestEmptyObject", `{}`, WeatherRecord{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got WeatherRecord
+			if err := json.Unmarshal([]byte(tt.payload), &got); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMixedStations(t *testing.T) {
+	t.Parallel()
+	// one station sends numbers, the other sends strings, in the same batch
+	payload := []byte(`[
+		{"dateutc":1697142300000,"winddir":239,"tempf":85.8},
+		{"dateutc":1697142000000,"winddir":"241","tempf":"85.1"}
+	]`)
+
+	for _, fields := range [][]string{nil, {"winddir", "tempf"}} {
+		got, err := decodeDeviceData(payload, newFetchOptions([]Option{WithFields(fields)}))
+		if err != nil {
+			t.Fatalf("decodeDeviceData(%v) error = %v", fields, err)
+		}
+		if len(got) != 2 || got[1].Winddir != 241 || got[1].Tempf != 85.1 {
+			t.Errorf("decodeDeviceData(%v) = %v, want the second record coerced", fields, got)
+		}
+		if fields != nil && got[1].Dateutc != 0 {
+			t.Errorf("decodeDeviceData(%v) kept dateutc = %v, want it skipped", fields, got[1].Dateutc)
+		}
+	}
+}
+
+func TestWeatherRecordUnmarshalJSONSensors(t *testing.T) {
+	t.Parallel()
+	ok, zero := 1, 0.0
+	pm25, pm2524h, co2, soiltemp1 := 12.5, 9.8, 415.0, 61.3
+
+	tests := []struct {
+		name    string
+		payload string
+		want    WeatherRecord
+	}{
+		{"TestAirQualityAndSoil",
+			`{"dateutc":1697142300000,"tempf":85.8,"batt1":1,"pm25":12.5,"pm25_24h":9.8,"co2":415,"soiltemp1":61.3}`,
+			WeatherRecord{Dateutc: 1697142300000, Tempf: 85.8, Batt1: &ok, Pm25: &pm25, Pm2524H: &pm2524h, Co2: &co2,
+				Soiltemp1: &soiltemp1}},
+		{"TestQuotedSensors", `{"pm25":"12.5","soiltemp1":"61.3","batt1":"1"}`,
+			WeatherRecord{Batt1: &ok, Pm25: &pm25, Soiltemp1: &soiltemp1}},
+		{"TestZeroReading", `{"pm25":0}`, WeatherRecord{Pm25: &zero}},
+		{"TestWithoutSensors", `{"dateutc":1697142300000,"tempf":85.8}`,
+			WeatherRecord{Dateutc: 1697142300000, Tempf: 85.8}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got WeatherRecord
+			if err := json.Unmarshal([]byte(tt.payload), &got); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// sensors that did not report are left out when marshaling
+	if got := (WeatherRecord{Tempf: 70}).String(); strings.Contains(got, "pm25") || strings.Contains(got, "soiltemp1") {
+		t.Errorf("String() = %v, want the missing sensors left out", got)
+	}
+}
+
+func TestWeatherRecordUnmarshalJSONFloatIntegers(t *testing.T) {
+	t.Parallel()
+	date := time.Date(2023, 10, 12, 20, 25, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		payload string
+		want    WeatherRecord
+	}{
+		{"TestScientificNotation", `{"dateutc":1.697142300000e12,"lightning_time":1.6971423e12}`,
+			WeatherRecord{Dateutc: 1697142300000, LightningTime: 1697142300000}},
+		{"TestQuotedScientificNotation", `{"dateutc":"1.6971423E+12","winddir":"2.39e2"}`,
+			WeatherRecord{Dateutc: 1697142300000, Winddir: 239}},
+		{"TestDecimalWithTrailingZeros", `{"dateutc":1697142300000.000}`, WeatherRecord{Dateutc: 1697142300000}},
+		{"TestEveryDigitKept", `{"dateutc":1.697142300123e12}`, WeatherRecord{Dateutc: 1697142300123}},
+		{"TestBeyondFloatPrecision", `{"lightning_time":9007199254740993.0}`,
+			WeatherRecord{LightningTime: 9007199254740993}},
+		{"TestFractionIgnored", `{"winddir":238.5,"lightning_time":1697142300000.7,"tempf":70}`,
+			WeatherRecord{Tempf: 70}},
+		{"TestQuotedFractionIgnored", `{"dateutc":"1.6971423000007e12","tempf":70}`, WeatherRecord{Tempf: 70}},
+		{"TestDateInScientificNotation", `{"date":1.6971423e12}`, WeatherRecord{Date: date}},
+		{"TestTooLarge", `{"dateutc":1e30,"tempf":70}`, WeatherRecord{Tempf: 70}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got WeatherRecord
+			if err := json.Unmarshal([]byte(tt.payload), &got); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherRecordUnmarshalJSONErrors(t *testing.T) {
+	t.Parallel()
+	for _, payload := range []string{`[1,2]`, `{"tz":12}`, `{"date":"yesterday"}`, `{"date":1697142300000.7}`} {
+		var got WeatherRecord
+		if err := json.Unmarshal([]byte(payload), &got); err == nil {
+			t.Errorf("UnmarshalJSON(%v) error = %v, want an error", payload, err)
+		}
+	}
+}
+
+func TestWeatherRecordUnmarshalJSONDate(t *testing.T) {
+	t.Parallel()
+	want := time.Date(2023, 10, 12, 20, 25, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"TestRFC3339", `{"date":"2023-10-12T20:25:00.000Z"}`},
+		{"TestEpochMilliseconds", `{"date":1697142300000}`},
+		{"TestQuotedEpochMilliseconds", `{"date":"1697142300000"}`},
+		{"TestEpochWithOtherOddFields", `{"date":1697142300000,"winddir":"239"}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got WeatherRecord
+			if err := json.Unmarshal([]byte(tt.payload), &got); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if !got.Date.Equal(want) {
+				t.Errorf("UnmarshalJSON() Date = %v, want %v", got.Date, want)
+			}
+		})
+	}
+
+	var got WeatherRecord
+	if err := json.Unmarshal([]byte(`{"lastRain":1697142300000}`), &got); err != nil || !got.LastRain.Equal(want) {
+		t.Errorf("UnmarshalJSON() LastRain = %v, %v, want %v", got.LastRain, err, want)
+	}
+}
@@ -3,6 +3,7 @@ package awn
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type errorType int
@@ -16,60 +17,143 @@ const (
 	errAppKeyMissing
 	errInvalidDateFormat
 	errMacAddressMissing
+	errUnknownField
+	errInvalidDateRange
+	errInvalidLimit
+	errUnexpectedDevicesResponse
+	errNoDataForRange
+	errRetryBudgetExhausted
+	errUnexpectedStatus
+	errPartialResponse
+	errMalformedMacAddress
+	errSchemaMismatch
+	errUnknownTimezone
+	errUnknownAPIError
+	errInvalidClientConfig
 )
 
 var (
-	ErrContextTimeoutExceeded = ClientError{kind: errContextTimeoutExceeded} //nolint:exhaustruct
-	ErrMalformedDate          = ClientError{kind: errMalformedDate}          //nolint:exhaustruct
-	ErrRegexFailed            = ClientError{kind: errRegexFailed}            //nolint:exhaustruct
-	ErrAPIKeyMissing          = ClientError{kind: errAPIKeyMissing}          //nolint:exhaustruct
-	ErrAppKeyMissing          = ClientError{kind: errAppKeyMissing}          //nolint:exhaustruct
-	ErrInvalidDateFormat      = ClientError{kind: errInvalidDateFormat}      //nolint:exhaustruct
-	ErrMacAddressMissing      = ClientError{kind: errMacAddressMissing}      //nolint:exhaustruct
+	ErrContextTimeoutExceeded    = ClientError{kind: errContextTimeoutExceeded}    //nolint:exhaustruct
+	ErrMalformedDate             = ClientError{kind: errMalformedDate}             //nolint:exhaustruct
+	ErrRegexFailed               = ClientError{kind: errRegexFailed}               //nolint:exhaustruct
+	ErrAPIKeyMissing             = ClientError{kind: errAPIKeyMissing}             //nolint:exhaustruct
+	ErrAppKeyMissing             = ClientError{kind: errAppKeyMissing}             //nolint:exhaustruct
+	ErrInvalidDateFormat         = ClientError{kind: errInvalidDateFormat}         //nolint:exhaustruct
+	ErrMacAddressMissing         = ClientError{kind: errMacAddressMissing}         //nolint:exhaustruct
+	ErrUnknownField              = ClientError{kind: errUnknownField}              //nolint:exhaustruct
+	ErrInvalidDateRange          = ClientError{kind: errInvalidDateRange}          //nolint:exhaustruct
+	ErrInvalidLimit              = ClientError{kind: errInvalidLimit}              //nolint:exhaustruct
+	ErrUnexpectedDevicesResponse = ClientError{kind: errUnexpectedDevicesResponse} //nolint:exhaustruct
+	ErrNoDataForRange            = ClientError{kind: errNoDataForRange}            //nolint:exhaustruct
+	ErrRetryBudgetExhausted      = ClientError{kind: errRetryBudgetExhausted}      //nolint:exhaustruct
+	ErrUnexpectedStatus          = ClientError{kind: errUnexpectedStatus}          //nolint:exhaustruct
+	ErrPartialResponse           = ClientError{kind: errPartialResponse}           //nolint:exhaustruct
+	ErrMalformedMacAddress       = ClientError{kind: errMalformedMacAddress}       //nolint:exhaustruct
+	ErrSchemaMismatch            = ClientError{kind: errSchemaMismatch}            //nolint:exhaustruct
+	ErrUnknownTimezone           = ClientError{kind: errUnknownTimezone}           //nolint:exhaustruct
+	ErrUnknownAPIError           = ClientError{kind: errUnknownAPIError}           //nolint:exhaustruct
+	ErrInvalidClientConfig       = ClientError{kind: errInvalidClientConfig}       //nolint:exhaustruct
 )
 
 // ClientError is a public custom error type that is used to return errors from the client.
 type ClientError struct {
-	kind  errorType // errKind in example
-	value int
-	err   error
+	kind     errorType // errKind in example
+	value    int
+	hasValue bool
+	detail   string
+	err      error
 }
 
-// Error is a public function that returns the error message.
+// Error is a public function that returns the error message. The message ends with the
+// detail of the error when it has one, or with its value when it was given one, so an
+// error that is returned as is only has its message.
 func (c ClientError) Error() string {
+	switch {
+	case c.detail != "":
+		return c.message() + ": " + c.detail
+	case c.hasValue:
+		return fmt.Sprintf("%s: %v", c.message(), c.value)
+	default:
+		return c.message()
+	}
+}
+
+// message is a private function that returns the message of the kind of the error.
+func (c ClientError) message() string {
 	switch c.kind {
 	case errContextTimeoutExceeded:
-		return fmt.Sprintf("context timeout exceeded: %v", c.value)
+		return "context timeout exceeded"
 	case errMalformedDate:
-		return fmt.Sprintf("date format is malformed. should be YYYY-MM-DD: %v", c.value)
+		return "date format is malformed. should be YYYY-MM-DD"
 	case errRegexFailed:
-		return fmt.Sprintf("regex failed: %v", c.value)
+		return "regex failed"
 	case errAPIKeyMissing:
-		return fmt.Sprintf("api key is missing: %v", c.value)
+		return "api key is missing"
 	case errAppKeyMissing:
-		return fmt.Sprintf("application key is missing: %v", c.value)
+		return "application key is missing"
 	case errInvalidDateFormat:
-		return fmt.Sprintf("date is invalid. It should be in epoch time in milliseconds: %v", c.value)
+		return "date is invalid. It should be in epoch time in milliseconds"
 	case errMacAddressMissing:
-		return fmt.Sprintf("mac address is missing: %v", c.value)
+		return "mac address is missing"
+	case errUnknownField:
+		return "unknown or unsupported weather record field"
+	case errInvalidDateRange:
+		return "start date is after end date"
+	case errInvalidLimit:
+		return "limit must be at least 1"
+	case errUnexpectedDevicesResponse:
+		return "expected weather records, but got a list of devices. is the mac address missing?"
+	case errNoDataForRange:
+		return "no data was found in the requested range"
+	case errRetryBudgetExhausted:
+		return "gave up retrying after the maximum elapsed time"
+	case errUnexpectedStatus:
+		return "api returned an unexpected status code"
+	case errPartialResponse:
+		return "response was cut off or is not valid json"
+	case errMalformedMacAddress:
+		return "mac address is malformed. should be like 00:11:22:33:44:55"
+	case errSchemaMismatch:
+		return "response has fields that WeatherRecord does not know about"
+	case errUnknownTimezone:
+		return "time zone of the weather station is missing or unknown"
+	case errUnknownAPIError:
+		return "api returned an error that the client does not recognize"
+	case errInvalidClientConfig:
+		return "client needs a valid base url and an api version"
 	default:
-		return fmt.Sprintf("unknown error: %v", c.value)
+		return "unknown error"
 	}
 }
 
 // from is a private function that returns an error with a particular location and the
 // underlying error.
-func (c ClientError) from(pos int, err error) ClientError { //nolint:unused
+func (c ClientError) from(pos int, err error) ClientError {
 	ce := c
 	ce.value = pos
+	ce.hasValue = true
 	ce.err = err
 	return ce
 }
 
 // with is a private function that returns an error with a particular value.
-func (c ClientError) with(val int) ClientError { //nolint:unused
+func (c ClientError) with(val int) ClientError {
 	ce := c
 	ce.value = val
+	ce.hasValue = true
+	return ce
+}
+
+// withDetail is a private function that returns an error with a detail, formatted like
+// fmt.Errorf, which takes the place of the value in the message. When the format wraps
+// an error with %w, that error becomes the underlying error.
+func (c ClientError) withDetail(format string, args ...any) ClientError {
+	ce := c
+	wrapped := fmt.Errorf(format, args...)
+	ce.detail = wrapped.Error()
+	if strings.Contains(format, "%w") {
+		ce.err = wrapped
+	}
 	return ce
 }
 
@@ -0,0 +1,187 @@
+package awn
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteCSV is a public function that writes the weather records in data to w as CSV,
+// with one header row and then one row per record, in the order that they are found in
+// data. The columns are the JSON names of the WeatherRecord fields, in the order that
+// they are declared, so they are stable between calls. Timestamps, including dateutc, are
+// written in RFC 3339 format in UTC, and empty timestamps or sensors that did not report
+// are left blank.
+//
+// Basic Usage:
+//
+//	resp, err := awn.GetHistoricalData(ctx, funcData, url, version)
+//	err = awn.WriteCSV(os.Stdout, resp)
+func WriteCSV(w io.Writer, data []DeviceDataResponse) error {
+	return WriteCSVRecords(w, Flatten(data))
+}
+
+// WriteCSVRecords is a public function that works like WriteCSV, but writes records of
+// any struct type. The columns are derived from the struct tags of T: each exported field
+// is a column named after its JSON name, or after the field itself when it has none, in
+// the order that the fields are declared. Fields tagged with "-" are skipped, and the
+// fields of an embedded struct are written in its place, so a type that embeds
+// WeatherRecord and adds its own sensors exports them as extra columns without any
+// change to the writer.
+//
+// Basic Usage:
+//
+//	type record struct {
+//		awn.WeatherRecord
+//		Soilhum1 *int `json:"soilhum1,omitempty"`
+//	}
+//	err = awn.WriteCSVRecords(os.Stdout, records)
+func WriteCSVRecords[T any](w io.Writer, records []T) error {
+	columns := csvSchema(reflect.TypeOf((*T)(nil)).Elem())
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+
+	writer := csv.NewWriter(w)
+
+	err := writer.Write(header)
+	if err != nil {
+		return fmt.Errorf("unable to write csv header: %w", err)
+	}
+
+	row := make([]string, len(columns))
+
+	for _, record := range records {
+		value := reflect.ValueOf(record)
+		for i, column := range columns {
+			row[i] = csvValue(column.name, value.FieldByIndex(column.index))
+		}
+
+		err = writer.Write(row)
+		if err != nil {
+			return fmt.Errorf("unable to write csv row: %w", err)
+		}
+	}
+
+	writer.Flush()
+
+	err = writer.Error()
+	if err != nil {
+		return fmt.Errorf("unable to write csv: %w", err)
+	}
+
+	return nil
+}
+
+// csvColumn is a single column of a CSV export: its name and the index sequence of the
+// struct field that it is read from, as used by reflect.Value.FieldByIndex.
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvSchema is a private helper function that returns the CSV columns of the struct type
+// t, in declaration order. The fields of embedded structs are inlined, and unexported
+// fields or fields tagged with "-" are skipped. A type that is not a struct has no
+// columns.
+func csvSchema(t reflect.Type) []csvColumn {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var columns []csvColumn
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for _, column := range csvSchema(field.Type) {
+				column.index = append([]int{i}, column.index...)
+				columns = append(columns, column)
+			}
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		columns = append(columns, csvColumn{name: name, index: []int{i}})
+	}
+
+	return columns
+}
+
+// csvValue is a private helper function that formats the value of a WeatherRecord field
+// for WriteCSV. The dateutc and lightning_time columns hold a Unix epoch time in
+// milliseconds, so they are formatted as dates.
+func csvValue(column string, value reflect.Value) string {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+
+		value = value.Elem()
+	}
+
+	switch v := value.Interface().(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+
+		return v.UTC().Format(time.RFC3339)
+	case int64:
+		if column != "dateutc" && column != "lightning_time" {
+			return strconv.FormatInt(v, 10)
+		}
+
+		if v == 0 {
+			return ""
+		}
+
+		return time.UnixMilli(v).UTC().Format(time.RFC3339)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteJSON is a public function that writes data to w as indented JSON, keeping one
+// array of weather records per page.
+//
+// Basic Usage:
+//
+//	resp, err := awn.GetHistoricalData(ctx, funcData, url, version)
+//	err = awn.WriteJSON(os.Stdout, resp)
+func WriteJSON(w io.Writer, data []DeviceDataResponse) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(data)
+	if err != nil {
+		return fmt.Errorf("unable to write json: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package awn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const csvGolden = `baromabsin,baromrelin,batt1,battin,batt_lightning,battout,co2,dailyrainin,date,dateutc,dewPoint,dewPointin,eventrainin,feelsLike,feelsLikein,hourlyrainin,humidity,humidityin,lastRain,lightning_day,lightning_distance,lightning_hour,lightning_time,maxdailygust,monthlyrainin,pm25,pm25_24h,soiltemp1,solarradiation,tempf,tempinf,tz,uv,weeklyrainin,winddir,winddir_avg10m,windgustmph,windspdmph_avg10m,windspeedmph,yearlyrainin
+0,0,,,0,1,,0,2023-10-12T20:25:00Z,2023-10-12T20:25:00Z,0,0,0,0,0,0,79,0,,0,0,0,,0,0,,,,0,85.8,0,America/Chicago,0,0,239,0,0,0,0,0
+0,29.775,,,0,,,0,2023-10-12T20:20:00Z,2023-10-12T20:20:00Z,0,0,0,0,0,0,0,0,2023-10-12T19:25:00Z,0,0,0,2023-10-12T18:25:00Z,0,0,,,,0,85.1,0,,0,0,0,0,0,0,0,0
+`
+
+const jsonGolden = `[
+  [
+    {
+      "baromabsin": 0,
+      "baromrelin": 0,
+      "batt_lightning": 0,
+      "battout": 1,
+      "dailyrainin": 0,
+      "date": "2023-10-12T20:25:00Z",
+      "dateutc": 1697142300000,
+      "dewPoint": 0,
+      "dewPointin": 0,
+      "eventrainin": 0,
+      "feelsLike": 0,
+      "feelsLikein": 0,
+      "hourlyrainin": 0,
+      "humidity": 79,
+      "humidityin": 0,
+      "lastRain": "0001-01-01T00:00:00Z",
+      "lightning_day": 0,
+      "lightning_distance": 0,
+      "lightning_hour": 0,
+      "lightning_time": 0,
+      "maxdailygust": 0,
+      "monthlyrainin": 0,
+      "solarradiation": 0,
+      "tempf": 85.8,
+      "tempinf": 0,
+      "tz": "America/Chicago",
+      "uv": 0,
+      "weeklyrainin": 0,
+      "winddir": 239,
+      "winddir_avg10m": 0,
+      "windgustmph": 0,
+      "windspdmph_avg10m": 0,
+      "windspeedmph": 0,
+      "yearlyrainin": 0
+    }
+  ]
+]
+`
+
+// exportData is a helper function that returns two pages of one record each for the
+// export tests.
+func exportData() []DeviceDataResponse {
+	ok := 1
+	date := time.Date(2023, 10, 12, 20, 25, 0, 0, time.UTC)
+
+	return []DeviceDataResponse{
+		{{
+			Battout: &ok, Date: date, Dateutc: date.UnixMilli(), Humidity: 79, Tempf: 85.8,
+			Tz: "America/Chicago", Winddir: 239,
+		}},
+		{{
+			Baromrelin: 29.775, Date: date.Add(-5 * time.Minute), Dateutc: date.Add(-5 * time.Minute).UnixMilli(),
+			LastRain: date.Add(-time.Hour), LightningTime: date.Add(-2 * time.Hour).UnixMilli(), Tempf: 85.1,
+		}},
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		data []DeviceDataResponse
+		want string
+	}{
+		{"TestTwoPages", exportData(), csvGolden},
+		{"TestHeaderOnly", nil, csvGolden[:bytes.IndexByte([]byte(csvGolden), '\n')+1]},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var b bytes.Buffer
+			if err := WriteCSV(&b, tt.data); err != nil {
+				t.Fatalf("WriteCSV() error = %v", err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("WriteCSV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSVRecordsAddedField(t *testing.T) {
+	t.Parallel()
+	type extendedRecord struct {
+		Station string `json:"station"`
+		WeatherRecord
+		Soilhum1 *int   `json:"soilhum1,omitempty"`
+		Note     string // no tag, so the field name is used
+		ignored  bool   //nolint:unused
+		Skipped  string `json:"-"`
+	}
+
+	soilhum := 42
+	records := []extendedRecord{
+		{Station: "backyard", WeatherRecord: exportData()[0][0], Soilhum1: &soilhum, Note: "wet"},
+		{Station: "cabin", WeatherRecord: exportData()[1][0]},
+	}
+
+	var b bytes.Buffer
+	if err := WriteCSVRecords(&b, records); err != nil {
+		t.Fatalf("WriteCSVRecords() error = %v", err)
+	}
+
+	// the WeatherRecord columns are inlined between the added ones
+	lines := strings.Split(strings.TrimSuffix(csvGolden, "\n"), "\n")
+	want := "station," + lines[0] + ",soilhum1,Note\n" +
+		"backyard," + lines[1] + ",42,wet\n" +
+		"cabin," + lines[2] + ",,\n"
+	if got := b.String(); got != want {
+		t.Errorf("WriteCSVRecords() = %v, want %v", got, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	if err := WriteJSON(&b, exportData()[:1]); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	if got := b.String(); got != jsonGolden {
+		t.Errorf("WriteJSON() = %v, want %v", got, jsonGolden)
+	}
+}
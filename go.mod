@@ -2,6 +2,8 @@ module github.com/d-dot-one/awn
 
 go 1.21.3
 
-require github.com/go-resty/resty/v2 v2.11.0
-
-require golang.org/x/net v0.18.0 // indirect
+require (
+	github.com/go-resty/resty/v2 v2.11.0
+	golang.org/x/net v0.18.0
+	golang.org/x/time v0.3.0
+)
@@ -0,0 +1,71 @@
+package awn
+
+import (
+	"sync"
+)
+
+// APIKeyPair is a struct that holds an API key and the Application key that goes with
+// it.
+type APIKeyPair struct {
+	API string `json:"api"`
+	App string `json:"app"`
+}
+
+// KeyPool is a struct that holds several APIKeyPair objects and hands them out
+// round-robin, so that the calls of a long fetch are spread over every key. The Ambient
+// Weather API limits calls per API key, so this lets heavy users stay under the limit
+// of each key. It is safe for concurrent use.
+//
+// Note that the rate limiter of the client still paces every call. To make use of the
+// extra keys, give the client a faster limiter with ClientOptions.RateLimiter, i.e. one
+// call per second per key.
+type KeyPool struct {
+	keys []APIKeyPair
+	mu   sync.Mutex
+	next int
+}
+
+// NewKeyPool is a public function that creates a KeyPool from the given key pairs, which
+// are handed out in the order that they are given. It returns ErrAPIKeyMissing or
+// ErrAppKeyMissing if no pairs are given or if one of them is missing a key.
+//
+// Basic Usage:
+//
+//	pool, err := awn.NewKeyPool(
+//		awn.APIKeyPair{API: "firstApiKey", App: "appKey"},
+//		awn.APIKeyPair{API: "secondApiKey", App: "appKey"},
+//	)
+func NewKeyPool(keys ...APIKeyPair) (*KeyPool, error) {
+	if len(keys) == 0 {
+		return nil, ErrAPIKeyMissing.withDetail("the key pool is empty")
+	}
+
+	for i, key := range keys {
+		if key.API == "" {
+			return nil, ErrAPIKeyMissing.withDetail("key pair %v", i)
+		}
+
+		if key.App == "" {
+			return nil, ErrAppKeyMissing.withDetail("key pair %v", i)
+		}
+	}
+
+	return &KeyPool{keys: append([]APIKeyPair(nil), keys...), mu: sync.Mutex{}, next: 0}, nil
+}
+
+// Next is a public method that returns the next APIKeyPair in the pool, starting over
+// from the first one after the last one has been handed out.
+func (p *KeyPool) Next() APIKeyPair {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := p.keys[p.next]
+	p.next = (p.next + 1) % len(p.keys)
+
+	return key
+}
+
+// Len is a public method that returns the number of key pairs in the pool.
+func (p *KeyPool) Len() int {
+	return len(p.keys)
+}
@@ -0,0 +1,102 @@
+package awn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyPoolNext(t *testing.T) {
+	t.Parallel()
+	pool, err := NewKeyPool(APIKeyPair{API: "a1", App: "app"}, APIKeyPair{API: "a2", App: "app"})
+	if err != nil {
+		t.Fatalf("NewKeyPool() error = %v", err)
+	}
+
+	want := []string{"a1", "a2", "a1", "a2", "a1"}
+	for i, w := range want {
+		if got := pool.Next().API; got != w {
+			t.Errorf("Next() call %v = %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestNewKeyPoolErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		keys    []APIKeyPair
+		wantErr error
+		wantMsg string
+	}{
+		{"TestEmpty", nil, ErrAPIKeyMissing, "api key is missing: the key pool is empty"},
+		{"TestMissingAPIKey", []APIKeyPair{{API: "a1", App: "app"}, {App: "app"}}, ErrAPIKeyMissing,
+			"api key is missing: key pair 1"},
+		{"TestMissingAppKey", []APIKeyPair{{API: "a1"}}, ErrAppKeyMissing, "application key is missing: key pair 0"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := NewKeyPool(tt.keys...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewKeyPool() error = %v, want %v", err, tt.wantErr)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("NewKeyPool() error = %q, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalDataKeyPool(t *testing.T) {
+	t.Parallel()
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	records := pagedHandler(recentRecords(6, time.Hour), false)
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			keys = append(keys, r.URL.Query().Get("apiKey")+"/"+r.URL.Query().Get("applicationKey"))
+			mu.Unlock()
+			records(w, r)
+		}))
+	defer s.Close()
+
+	pool, err := NewKeyPool(
+		APIKeyPair{API: "a1", App: "p1"}, APIKeyPair{API: "a2", App: "p2"}, APIKeyPair{API: "a3", App: "p3"})
+	if err != nil {
+		t.Fatalf("NewKeyPool() error = %v", err)
+	}
+
+	fd := FunctionData{
+		API: "unused", App: "unused", Limit: 1, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-24 * time.Hour).UnixMilli(),
+	}
+
+	_, err = GetHistoricalData(context.Background(), fd, s.URL, "/v1",
+		WithClientOptions(testClientOptions()), WithKeyPool(pool))
+	if err != nil {
+		t.Fatalf("GetHistoricalData() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// six pages of one record, plus the empty page that ends the fetch
+	want := []string{"a1/p1", "a2/p2", "a3/p3", "a1/p1", "a2/p2", "a3/p3", "a1/p1"}
+	if len(keys) != len(want) {
+		t.Fatalf("server received %v requests, want %v", len(keys), len(want))
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("request %v used keys %v, want %v", i, keys[i], want[i])
+		}
+	}
+}
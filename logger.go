@@ -0,0 +1,163 @@
+package awn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// logger is the package-wide structured logger. It is a pointer so that SetLogger can
+// swap it while requests are in flight.
+var logger atomic.Pointer[slog.Logger] //nolint:gochecknoglobals
+
+// SetLogger is a public function that routes every log message of the package,
+// including those of the underlying resty client, to l. Messages carry attributes such
+// as the endpoint, the MAC address and the epoch of the request. By default, nothing is
+// logged. Passing nil restores the default. The request dumps of ClientOptions.Debug are
+// logged at the debug level, so the handler must enable it to show them.
+//
+// Basic Usage:
+//
+//	awn.SetLogger(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// getLogger is a private helper function that returns the logger set by SetLogger. If
+// there is none, it returns a logger that discards everything or, when debugMode is
+// set, one that writes every message down to the debug level to stderr. Either way, the
+// API and Application keys are masked, see redactHandler.
+func getLogger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return slog.New(redactHandler{next: l.Handler()})
+	}
+
+	if debugMode {
+		handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}) //nolint:exhaustruct
+		return slog.New(redactHandler{next: handler})
+	}
+
+	return slog.New(discardHandler{})
+}
+
+// discardHandler is a private slog.Handler that drops every record.
+type discardHandler struct{}
+
+// Enabled is a public method that reports that no level is enabled.
+func (discardHandler) Enabled(context.Context, slog.Level) bool { return false }
+
+// Handle is a public method that drops the record.
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+
+// WithAttrs is a public method that returns the handler unchanged.
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler { return d }
+
+// WithGroup is a public method that returns the handler unchanged.
+func (d discardHandler) WithGroup(string) slog.Handler { return d }
+
+// secretParams matches the query parameters that hold the API and Application keys,
+// wherever they show up in a URL.
+var secretParams = regexp.MustCompile(`\b((?:apiKey|applicationKey)=)[^&\s"]*`) //nolint:gochecknoglobals
+
+// redactKeys is a private helper function that replaces the value of every apiKey and
+// applicationKey query parameter in s with ***.
+func redactKeys(s string) string {
+	return secretParams.ReplaceAllString(s, "${1}***")
+}
+
+// redactHandler is a private slog.Handler that masks the API and Application keys in
+// the message and attributes of every record before it is passed on to next. The keys
+// are sent in the query string, so they show up in the request dumps of
+// ClientOptions.Debug and in the URL of most request errors.
+type redactHandler struct {
+	next slog.Handler
+}
+
+// Enabled is a public method that reports whether next handles the level.
+func (h redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle is a public method that masks the keys in the record and passes it to next.
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, redactKeys(r.Message), r.PC)
+
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+
+	return h.next.Handle(ctx, redacted) //nolint:wrapcheck
+}
+
+// WithAttrs is a public method that masks the keys in attrs and adds them to next.
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+
+	return redactHandler{next: h.next.WithAttrs(redacted)}
+}
+
+// WithGroup is a public method that opens the group on next.
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr is a private helper function that masks the keys in the value of a, which
+// can be a string, a group or any value that prints a key, such as an error or a URL.
+// Values without a key are left untouched.
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactKeys(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		text := fmt.Sprint(a.Value.Any())
+		if masked := redactKeys(text); masked != text {
+			return slog.String(a.Key, masked)
+		}
+	}
+
+	return a
+}
+
+// restyLogger is a private adapter that sends the messages of the resty client to the
+// package logger. The request dumps that resty writes when ClientOptions.Debug is set
+// are logged at the debug level.
+type restyLogger struct{}
+
+// Errorf is a public method that logs a resty error.
+func (restyLogger) Errorf(format string, v ...any) {
+	getLogger().Error(restyMessage(format, v), "source", "resty")
+}
+
+// Warnf is a public method that logs a resty warning.
+func (restyLogger) Warnf(format string, v ...any) {
+	getLogger().Warn(restyMessage(format, v), "source", "resty")
+}
+
+// Debugf is a public method that logs a resty debug message.
+func (restyLogger) Debugf(format string, v ...any) {
+	getLogger().Debug(restyMessage(format, v), "source", "resty")
+}
+
+// restyMessage is a private helper function that formats a resty message without the
+// trailing newline that resty adds.
+func restyMessage(format string, v []any) string {
+	return strings.TrimSpace(fmt.Sprintf(format, v...))
+}
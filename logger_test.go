@@ -0,0 +1,175 @@
+package awn
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureHandler is a slog.Handler that keeps every record that it handles, so tests can
+// assert on them.
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (c *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (c *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, r)
+	return nil
+}
+
+func (c *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return c }
+
+func (c *captureHandler) WithGroup(string) slog.Handler { return c }
+
+// find returns the attributes of the first record with the given message and level.
+func (c *captureHandler) find(level slog.Level, msg string) (map[string]slog.Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.records {
+		if r.Level != level || r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return attrs, true
+	}
+	return nil, false
+}
+
+func TestSetLogger(t *testing.T) {
+	// not parallel, since the logger is shared by the whole package
+	handler := &captureHandler{}
+	SetLogger(slog.New(handler))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"apiKey-missing"}`))
+		}))
+	defer s.Close()
+
+	fd := FunctionData{API: "revoked", App: "app", Epoch: 1697142300000, Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(testClientOptions()))
+	if err == nil {
+		t.Fatalf("getDeviceData() error = %v, want an error", err)
+	}
+
+	attrs, ok := handler.find(slog.LevelError, "api returned an error")
+	if !ok {
+		t.Fatalf("no error was logged, got %v records", len(handler.records))
+	}
+
+	want := map[string]string{
+		"endpoint": devicesEndpoint,
+		"mac":      "00:11:22:33:44:55",
+		"epoch":    "1697142300000",
+		"error":    ErrAPIKeyMissing.Error(),
+	}
+	for key, value := range want {
+		if got, ok := attrs[key]; !ok || got.String() != value {
+			t.Errorf("logged %v = %v, want %v", key, got, value)
+		}
+	}
+}
+
+func TestRestyLogger(t *testing.T) {
+	// not parallel, since the logger is shared by the whole package
+	handler := &captureHandler{}
+	SetLogger(slog.New(handler))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	restyLogger{}.Warnf("retrying %v\n", "request")
+
+	attrs, ok := handler.find(slog.LevelWarn, "retrying request")
+	if !ok || attrs["source"].String() != "resty" {
+		t.Errorf("resty warning was not logged with source=resty, got %v", handler.records)
+	}
+}
+
+func TestDebugRedactsKeys(t *testing.T) {
+	// not parallel, since the logger is shared by the whole package
+	handler := &captureHandler{}
+	SetLogger(slog.New(handler))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	defer s.Close()
+
+	opts := testClientOptions()
+	opts.Debug = true
+	opts.DisableRetries = true
+	fd := FunctionData{API: "secret-api", App: "secret-app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	// the error of a failed request holds the whole URL
+	_, _ = getDeviceData(context.Background(), fd, "http://127.0.0.1:1", "/v1", WithClientOptions(opts))
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	var logged strings.Builder
+	for _, r := range handler.records {
+		logged.WriteString(r.Message + "\n")
+		r.Attrs(func(a slog.Attr) bool {
+			logged.WriteString(a.String() + "\n")
+			return true
+		})
+	}
+
+	output := logged.String()
+	if strings.Contains(output, "secret-api") || strings.Contains(output, "secret-app") {
+		t.Errorf("debug output has the keys in it:\n%v", output)
+	}
+	for _, want := range []string{"apiKey=***", "applicationKey=***", "connection refused"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("debug output does not have %q in it:\n%v", want, output)
+		}
+	}
+}
+
+func TestRedactKeys(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/v1/devices?apiKey=abc&applicationKey=def&limit=1", "/v1/devices?apiKey=***&applicationKey=***&limit=1"},
+		{`Get "http://host/v1/devices?applicationKey=def": refused`,
+			`Get "http://host/v1/devices?applicationKey=***": refused`},
+		{"limit=1&endDate=1697142300000", "limit=1&endDate=1697142300000"},
+		{"myapiKey=abc", "myapiKey=abc"},
+	}
+	for _, tt := range tests {
+		if got := redactKeys(tt.in); got != tt.want {
+			t.Errorf("redactKeys(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultLoggerDiscards(t *testing.T) {
+	t.Parallel()
+	if getLogger().Enabled(context.Background(), slog.LevelError) {
+		t.Errorf("default logger is enabled, want it to discard everything")
+	}
+}
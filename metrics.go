@@ -0,0 +1,127 @@
+package awn
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// MetricsRecorder is an interface that is told about every call to the API, once it is
+// over. endpoint names the route that was called, with the MAC address left as a
+// placeholder so that it can be used as a metric label (i.e. "devices" or
+// "devices/{macAddress}"). status is the HTTP status code, or 0 when no response was
+// received, and dur is how long the call took. Each retry is a call of its own, whether
+// it got a response or not.
+//
+// This keeps the package free of any metrics library. For example, a Prometheus adapter
+// could look like this:
+//
+//	type promRecorder struct {
+//		calls   *prometheus.CounterVec   // labels: endpoint, status
+//		latency *prometheus.HistogramVec // labels: endpoint
+//	}
+//
+//	func (p promRecorder) ObserveRequest(endpoint string, status int, dur time.Duration) {
+//		p.calls.WithLabelValues(endpoint, strconv.Itoa(status)).Inc()
+//		p.latency.WithLabelValues(endpoint).Observe(dur.Seconds())
+//	}
+//
+// ObserveRequest may be called from several goroutines at once.
+type MetricsRecorder interface {
+	ObserveRequest(endpoint string, status int, dur time.Duration)
+}
+
+// noopMetrics is the default MetricsRecorder, which drops every observation.
+type noopMetrics struct{}
+
+// ObserveRequest is a public method that does nothing.
+func (noopMetrics) ObserveRequest(string, int, time.Duration) {}
+
+// metricsEndpointKey is the context key under which stampEndpoint stores the endpoint
+// of a request.
+type metricsEndpointKey struct{}
+
+// stampEndpoint is a private function, used as a resty.RequestMiddleware, that records
+// the endpoint of a request before resty replaces its route with the full URL. Later
+// attempts reuse the same context, so the endpoint is only stored once.
+func stampEndpoint(_ *resty.Client, r *resty.Request) error {
+	if _, ok := r.Context().Value(metricsEndpointKey{}).(string); !ok {
+		r.SetContext(context.WithValue(r.Context(), metricsEndpointKey{}, metricsEndpoint(r)))
+	}
+
+	return nil
+}
+
+// observeResponse is a private function, used as a resty.ResponseMiddleware, that passes
+// each response to metrics.
+func observeResponse(metrics MetricsRecorder) resty.ResponseMiddleware {
+	return func(_ *resty.Client, r *resty.Response) error {
+		metrics.ObserveRequest(stampedEndpoint(r.Request), r.StatusCode(), r.Time())
+
+		return nil
+	}
+}
+
+// observedAttemptKey is the context key under which observeRetry stores the number of
+// the last attempt that it passed to metrics.
+type observedAttemptKey struct{}
+
+// observeRetry is a private function, used as a resty.OnRetryFunc, that passes each
+// attempt that failed without a response and is retried to metrics, with a status of 0.
+// Attempts that got a response were already observed by observeResponse.
+func observeRetry(metrics MetricsRecorder) resty.OnRetryFunc {
+	return func(resp *resty.Response, err error) {
+		if err == nil || resp == nil || resp.RawResponse != nil || resp.Request.Time.IsZero() {
+			return
+		}
+
+		r := resp.Request
+		metrics.ObserveRequest(stampedEndpoint(r), 0, time.Since(r.Time))
+		r.SetContext(context.WithValue(r.Context(), observedAttemptKey{}, r.Attempt))
+	}
+}
+
+// observeError is a private function, used as a resty.ErrorHook, that passes each call
+// that failed without a response to metrics, with a status of 0. Calls that got a
+// response were already observed by observeResponse, a last attempt that was already
+// observed by observeRetry is skipped, and calls that were never sent, such as when the
+// rate limiter gives up waiting, are not observed at all.
+func observeError(metrics MetricsRecorder) resty.ErrorHook {
+	return func(r *resty.Request, err error) {
+		var responseErr *resty.ResponseError
+		if errors.As(err, &responseErr) && responseErr.Response.RawResponse != nil || r.Time.IsZero() {
+			return
+		}
+
+		if attempt, ok := r.Context().Value(observedAttemptKey{}).(int); ok && attempt == r.Attempt {
+			return
+		}
+
+		metrics.ObserveRequest(stampedEndpoint(r), 0, time.Since(r.Time))
+	}
+}
+
+// metricsEndpoint is a private helper function that returns the route of r, relative to
+// the base URL, with every path parameter but the MAC address filled in.
+func metricsEndpoint(r *resty.Request) string {
+	endpoint := r.URL
+
+	for name, value := range r.PathParams {
+		if name != "macAddress" {
+			endpoint = strings.ReplaceAll(endpoint, "{"+name+"}", value)
+		}
+	}
+
+	return strings.TrimPrefix(endpoint, "/")
+}
+
+// stampedEndpoint is a private helper function that returns the endpoint stored by
+// stampEndpoint.
+func stampedEndpoint(r *resty.Request) string {
+	endpoint, _ := r.Context().Value(metricsEndpointKey{}).(string)
+
+	return endpoint
+}
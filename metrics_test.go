@@ -0,0 +1,148 @@
+package awn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// observation is a single call to fakeRecorder.ObserveRequest.
+type observation struct {
+	endpoint string
+	status   int
+	dur      time.Duration
+}
+
+// fakeRecorder is a MetricsRecorder that keeps every observation.
+type fakeRecorder struct {
+	mu           sync.Mutex
+	observations []observation
+}
+
+func (f *fakeRecorder) ObserveRequest(endpoint string, status int, dur time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.observations = append(f.observations, observation{endpoint, status, dur})
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the first call to the macAddress endpoint fails once and is retried
+			if r.URL.Path != "/v1/devices" && atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	t.Cleanup(s.Close)
+
+	recorder := &fakeRecorder{}
+	opts := testClientOptions()
+	opts.Metrics = recorder
+	fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+	_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("getDeviceData() error = %v", err)
+	}
+
+	_, err = GetLatestData(context.Background(), fd, s.URL, "/v1", WithClientOptions(opts))
+	if err != nil {
+		t.Fatalf("GetLatestData() error = %v", err)
+	}
+
+	unreachable := opts
+	unreachable.DisableRetries = true
+	_, _ = getDeviceData(context.Background(), fd, "http://127.0.0.1:1", "/v1", WithClientOptions(unreachable))
+
+	want := []observation{
+		{"devices/{macAddress}", http.StatusServiceUnavailable, 0},
+		{"devices/{macAddress}", http.StatusOK, 0},
+		{"devices", http.StatusOK, 0},
+		{"devices/{macAddress}", 0, 0},
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.observations) != len(want) {
+		t.Fatalf("ObserveRequest() was called %v times, want %v: %+v", len(recorder.observations), len(want),
+			recorder.observations)
+	}
+	for i, got := range recorder.observations {
+		if got.endpoint != want[i].endpoint || got.status != want[i].status || got.dur <= 0 {
+			t.Errorf("observation %v = %+v, want %v with status %v and a duration", i, got, want[i].endpoint,
+				want[i].status)
+		}
+	}
+}
+
+// flakyTransport is an http.RoundTripper that fails the first failures calls without a
+// response, then sends the rest with http.DefaultTransport.
+type flakyTransport struct {
+	failures int32
+	calls    int32
+}
+
+func (f *flakyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if atomic.AddInt32(&f.calls, 1) <= f.failures {
+		return nil, errors.New("connection reset by peer")
+	}
+
+	return http.DefaultTransport.RoundTrip(r) //nolint:wrapcheck
+}
+
+func TestMetricsRecorderRetriedTransportError(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`[]`))
+		}))
+	t.Cleanup(s.Close)
+
+	tests := []struct {
+		name     string
+		failures int32
+		want     []int
+		wantErr  bool
+	}{
+		{"TestRecovers", 2, []int{0, 0, http.StatusOK}, false},
+		{"TestGivesUp", 10, []int{0, 0, 0}, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			recorder := &fakeRecorder{}
+			opts := testClientOptions()
+			opts.RetryCount = 2
+			opts.Metrics = recorder
+			opts.Transport = &flakyTransport{failures: tt.failures}
+			fd := FunctionData{API: "api", App: "app", Limit: 1, Mac: "00:11:22:33:44:55"}
+
+			_, err := getDeviceData(context.Background(), fd, s.URL, "/v1", WithClientOptions(opts))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getDeviceData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			if len(recorder.observations) != len(tt.want) {
+				t.Fatalf("ObserveRequest() was called %v times, want %v: %+v", len(recorder.observations),
+					len(tt.want), recorder.observations)
+			}
+			for i, got := range recorder.observations {
+				if got.endpoint != "devices/{macAddress}" || got.status != tt.want[i] || got.dur <= 0 {
+					t.Errorf("observation %v = %+v, want status %v and a duration", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -1,40 +1,848 @@
-// this is obviously a work in progress.
-
 package awn
 
-const (
-	// apiVersionRealtime is a string and describes the version of the real-time API.
-	apiVersionRealtime = "/api=1"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
 
-	// baseUrlRealtime The base URL for the Ambient Weather real-time API as a string.
+const (
+	// baseURLRealtime The base URL for the Ambient Weather real-time API as a string.
 	baseURLRealtime = "wss://rt2.ambientweather.net"
+
+	// realtimePath is the path of the Socket.IO endpoint of the real-time API.
+	realtimePath = "/socket.io/"
+
+	// realtimeStatusBuffer is the number of RealtimeStatus values that the status channel
+	// of GetRealtimeData holds before new ones are dropped.
+	realtimeStatusBuffer = 16
+
+	// defaultPingInterval and defaultPingTimeout are the Engine.IO keepalive timings, in
+	// milliseconds, that are used when the server does not send its own.
+	defaultPingInterval = 25000
+	defaultPingTimeout  = 20000
+)
+
+// The real-time API speaks Socket.IO v2, which is framed by version 3 of the Engine.IO
+// protocol. Each WebSocket message starts with these packet types.
+const (
+	engineOpen       = "0"
+	engineClose      = "1"
+	enginePing       = "2"
+	enginePong       = "3"
+	socketConnect    = "40"
+	socketDisconnect = "41"
+	socketEvent      = "42"
 )
 
-// GetRealtimeData is a public function that will connect to the Ambient Weather real-time
-// weather API via Websockets and fetch live data.
-func GetRealtimeData() (string, error) {
-	/*
-		https://ambientweather.docs.apiary.io/#reference/ambient-realtime-api
+// errRealtimeClosed is returned when the real-time API closes the connection on its own.
+var errRealtimeClosed = errors.New("the realtime api closed the connection")
+
+// ConnectionState describes the state of the connection to the real-time API.
+type ConnectionState int
+
+const (
+	_ ConnectionState = iota // so we don't start at 0
+	Connected
+	Reconnecting
+	Disconnected
+)
+
+// String is a public method that returns the name of the ConnectionState.
+func (s ConnectionState) String() string {
+	switch s {
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	case Disconnected:
+		return "Disconnected"
+	default:
+		return fmt.Sprintf("ConnectionState(%d)", int(s))
+	}
+}
+
+// RealtimeStatus is sent on the status channel of GetRealtimeData each time that the
+// connection changes state. While Reconnecting, Attempt is the number of the
+// reconnection attempt, starting at 1. Err is the error that dropped the connection, if
+// there was one.
+type RealtimeStatus struct {
+	State   ConnectionState `json:"state"`
+	Attempt int             `json:"attempt"`
+	Err     error           `json:"-"`
+}
+
+// RealtimeRecord is a single weather reading that is pushed by the real-time API, along
+// with the MAC address of the weather station that sent it.
+type RealtimeRecord struct {
+	MacAddress string `json:"macAddress"`
+	WeatherRecord
+}
+
+// UnmarshalJSON is a public method that decodes a real-time reading. It is needed
+// because the embedded WeatherRecord has its own UnmarshalJSON, which would otherwise
+// be promoted and skip the MAC address.
+func (r *RealtimeRecord) UnmarshalJSON(data []byte) error {
+	var station struct {
+		MacAddress string `json:"macAddress"`
+	}
+
+	err := json.Unmarshal(data, &station)
+	if err != nil {
+		return fmt.Errorf("unable to decode realtime record: %w", err)
+	}
+
+	err = r.WeatherRecord.UnmarshalJSON(data)
+	if err != nil {
+		return err
+	}
+
+	r.MacAddress = station.MacAddress
+
+	return nil
+}
+
+// RealtimeOption is a functional option that changes the behavior of GetRealtimeData.
+type RealtimeOption func(*realtimeOptions)
+
+// realtimeOptions is a private struct that holds the values that are set by each
+// RealtimeOption.
+type realtimeOptions struct {
+	maxReconnects int
+	minWait       time.Duration
+	maxWait       time.Duration
+	userAgent     string
+}
+
+// newRealtimeOptions is a private helper function that applies each RealtimeOption, in
+// order, to a realtimeOptions struct holding the defaults and returns it.
+func newRealtimeOptions(opts []RealtimeOption) realtimeOptions {
+	options := realtimeOptions{
+		maxReconnects: -1,
+		minWait:       retryMinWaitTimeSeconds * time.Second,
+		maxWait:       retryMaxWaitTimeSeconds * time.Second,
+		userAgent:     defaultUserAgent(),
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// WithMaxReconnects is a public function that returns a RealtimeOption that gives up
+// after n reconnection attempts in a row have failed. The count starts over each time
+// that a reconnection succeeds. Zero never reconnects, and a negative n, the default,
+// keeps trying until the context is done.
+//
+// Basic Usage:
+//
+//	client, err := awn.GetRealtimeData(ctx, funcData, url, awn.WithMaxReconnects(5))
+func WithMaxReconnects(n int) RealtimeOption {
+	return func(o *realtimeOptions) {
+		o.maxReconnects = n
+	}
+}
+
+// WithReconnectWait is a public function that returns a RealtimeOption that sets the
+// bounds of the wait between reconnection attempts. The wait starts at minWait and
+// doubles with each failed attempt, up to maxWait. A value less than 1 keeps the
+// default, which is the same as the retry wait of the REST client.
+//
+// Basic Usage:
+//
+//	client, err := awn.GetRealtimeData(ctx, funcData, url,
+//		awn.WithReconnectWait(time.Second, time.Minute))
+func WithReconnectWait(minWait time.Duration, maxWait time.Duration) RealtimeOption {
+	return func(o *realtimeOptions) {
+		if minWait > 0 {
+			o.minWait = minWait
+		}
+
+		if maxWait > 0 {
+			o.maxWait = maxWait
+		}
+	}
+}
+
+// WithRealtimeUserAgent is a public function that returns a RealtimeOption that sets
+// the User-Agent header of the WebSocket handshake, just like the UserAgent field of
+// ClientOptions does for the REST client. An empty userAgent keeps the default.
+//
+// Basic Usage:
+//
+//	client, err := awn.GetRealtimeData(ctx, funcData, url,
+//		awn.WithRealtimeUserAgent("my-integration/1.0"))
+func WithRealtimeUserAgent(userAgent string) RealtimeOption {
+	return func(o *realtimeOptions) {
+		if userAgent != "" {
+			o.userAgent = userAgent
+		}
+	}
+}
+
+// backoff is a private method that returns the wait before the given reconnection
+// attempt, which doubles with each attempt and is never more than maxWait.
+func (o realtimeOptions) backoff(attempt int) time.Duration {
+	return time.Duration(min(float64(o.maxWait), float64(o.minWait)*math.Exp2(float64(attempt-1))))
+}
+
+// engineSession holds the keepalive timings that the server sends when a connection is
+// opened.
+type engineSession struct {
+	PingInterval int64 `json:"pingInterval"`
+	PingTimeout  int64 `json:"pingTimeout"`
+}
+
+// RealtimeClient is a handle to a connection to the real-time API, which is returned by
+// GetRealtimeData. It holds the channels that readings and changes of state are sent on,
+// and the weather stations that the API keys are subscribed to. Call Close once it is no
+// longer needed.
+type RealtimeClient struct {
+	config  *websocket.Config
+	options realtimeOptions
+	data    chan RealtimeRecord
+	status  chan RealtimeStatus
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu         sync.Mutex
+	conn       *websocket.Conn
+	keys       []string
+	devices    AmbientDevice
+	deviceKeys map[string]string
+	muted      map[string]struct{}
+}
+
+// Data is a public method that returns the channel that each reading is sent on. It is
+// closed once the connection is given up for good.
+func (c *RealtimeClient) Data() <-chan RealtimeRecord {
+	return c.data
+}
+
+// Status is a public method that returns the channel that each change of state of the
+// connection is sent on. Sends on it never block, so it holds a few values and later ones
+// are dropped until it is read. It is closed along with the data channel.
+func (c *RealtimeClient) Status() <-chan RealtimeStatus {
+	return c.status
+}
+
+// Close is a public method that shuts the connection down: it stops the keepalive,
+// closes the socket and waits until both channels are closed, after a last Disconnected
+// status. Readings that were not received yet are dropped. It is the same as canceling
+// the context that was passed to GetRealtimeData, and it is safe to call more than once.
+//
+// Basic Usage:
+//
+//	client, err := awn.GetRealtimeData(ctx, funcData, "")
+//	defer client.Close()
+func (c *RealtimeClient) Close() error {
+	c.cancel()
+	<-c.done
+
+	return nil
+}
+
+// SubscribedDevices is a public method that returns the name and location of every
+// weather station that the API keys are subscribed to, as listed by the real-time API
+// when the subscription is confirmed. This saves a call to GetLatestData to learn the
+// station roster. It is empty until the first confirmation arrives, which is before the
+// first reading, and is updated each time that the keys are subscribed again.
+//
+// Basic Usage:
+//
+//	for _, station := range client.SubscribedDevices() {
+//		fmt.Println(station.MacAddress, station.Name)
+//	}
+func (c *RealtimeClient) SubscribedDevices() []StationLocation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices := slices.DeleteFunc(slices.Clone(c.devices), func(device Device) bool {
+		return c.isMuted(device.MacAddress)
+	})
+
+	return devices.Locations()
+}
+
+// Unsubscribe is a public method that stops the readings of the given weather stations,
+// by their MAC addresses, without closing the connection. The real-time API subscribes by
+// API key rather than by weather station, so readings from a station are dropped by the
+// client, and once every station of an API key is unsubscribed, an unsubscribe command
+// for the key is sent so that the API stops pushing them at all. The stations are left
+// out of SubscribedDevices, and stay unsubscribed when the connection is opened again.
+// It returns ErrMalformedMacAddress for a MAC address that is not valid, before anything
+// changes, or the error of sending the command, in which case the change still holds and
+// is applied when the connection is opened again.
+//
+// Basic Usage:
+//
+//	err := client.Unsubscribe("00:11:22:33:44:55")
+func (c *RealtimeClient) Unsubscribe(macs ...string) error {
+	normalized, err := normalizeMacAddresses(macs)
+	if err != nil {
+		return err
+	}
+
+	conn, keys := c.mute(normalized)
+
+	return sendSubscription(conn, "unsubscribe", keys)
+}
+
+// mute is a private method that unsubscribes the weather stations with the given
+// normalized MAC addresses. It returns the open connection, if there is one, and the API
+// keys that no longer have any subscribed station, which the caller sends an unsubscribe
+// command for once c.mu is released.
+func (c *RealtimeClient) mute(macs []string) (*websocket.Conn, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, mac := range macs {
+		c.muted[mac] = struct{}{}
+	}
+
+	var keys []string
+
+	for _, key := range c.keys {
+		if c.keyMuted(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	c.keys = slices.DeleteFunc(c.keys, func(key string) bool { return slices.Contains(keys, key) })
+
+	return c.conn, keys
+}
+
+// Subscribe is a public method that resumes the readings of the given weather stations,
+// by their MAC addresses, after a call to Unsubscribe. If the API key of a station was
+// unsubscribed, a subscribe command for it is sent on the open connection. Like
+// Unsubscribe, it returns ErrMalformedMacAddress for a MAC address that is not valid, or
+// the error of sending the command.
+//
+// Basic Usage:
+//
+//	err := client.Subscribe("00:11:22:33:44:55")
+func (c *RealtimeClient) Subscribe(macs ...string) error {
+	normalized, err := normalizeMacAddresses(macs)
+	if err != nil {
+		return err
+	}
+
+	conn, keys := c.unmute(normalized)
+
+	return sendSubscription(conn, "subscribe", keys)
+}
+
+// unmute is a private method that subscribes the weather stations with the given
+// normalized MAC addresses again. It returns the open connection, if there is one, and
+// the API keys that were unsubscribed, which the caller sends a subscribe command for
+// once c.mu is released.
+func (c *RealtimeClient) unmute(macs []string) (*websocket.Conn, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var keys []string
 
-		setup: https://rt2.ambientweather.net/?api=1&applicationKey=AppKey
-		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-		defer cancel()
+	for _, mac := range macs {
+		delete(c.muted, mac)
 
-		c, _, err := websocket.Dial(ctx, "ws://localhost:8080", nil)
+		key, ok := c.deviceKeys[mac]
+		if ok && !slices.Contains(c.keys, key) && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	c.keys = append(c.keys, keys...)
+
+	return c.conn, keys
+}
+
+// sendSubscription is a private function that sends a subscription command for keys on
+// conn, unless there is no connection or there are no keys. It is called without
+// holding c.mu, so that a slow socket does not hold up the rest of the client.
+func sendSubscription(conn *websocket.Conn, command string, keys []string) error {
+	if conn == nil || len(keys) == 0 {
+		return nil
+	}
+
+	return sendEvent(conn, command, map[string][]string{"apiKeys": keys})
+}
+
+// isMuted is a private method that reports whether the weather station with the given
+// MAC address was unsubscribed. The caller must hold c.mu.
+func (c *RealtimeClient) isMuted(mac string) bool {
+	normalized, err := NormalizeMacAddress(mac)
+	if err != nil {
+		return false
+	}
+
+	_, ok := c.muted[normalized]
+
+	return ok
+}
+
+// keyMuted is a private method that reports whether every known weather station of the
+// API key was unsubscribed. A key without any known station is never muted. The caller
+// must hold c.mu.
+func (c *RealtimeClient) keyMuted(key string) bool {
+	found := false
+
+	for mac, deviceKey := range c.deviceKeys {
+		if deviceKey != key {
+			continue
+		}
+
+		if _, ok := c.muted[mac]; !ok {
+			return false
+		}
+
+		found = true
+	}
+
+	return found
+}
+
+// normalizeMacAddresses is a private helper function that normalizes each MAC address
+// with NormalizeMacAddress, and returns the first error.
+func normalizeMacAddresses(macs []string) ([]string, error) {
+	normalized := make([]string, len(macs))
+
+	for i, mac := range macs {
+		var err error
+
+		normalized[i], err = NormalizeMacAddress(mac)
 		if err != nil {
-			// ...
+			return nil, err
 		}
-		defer c.CloseNow()
+	}
+
+	return normalized, nil
+}
+
+// GetRealtimeData is a public function that connects to the Ambient Weather real-time
+// API, subscribes with every API key of the FunctionData and returns a RealtimeClient
+// that streams each reading that is pushed to it on its Data channel. An empty url
+// connects to the public real-time API.
+//
+// If the connection drops, it is opened again after a wait that starts at the retry
+// minimum of the REST client and doubles with each failed attempt, up to its maximum
+// (see WithReconnectWait), and the same keys are subscribed again. Each change of state
+// is sent on the Status channel. Reconnection attempts can be capped with
+// WithMaxReconnects.
+//
+// The first connection is made before GetRealtimeData returns, so bad keys or an
+// unreachable server are returned as an error. After that, the stream runs until ctx is
+// done, Close is called or the reconnection attempts run out, at which point a
+// Disconnected status is sent and both channels are closed.
+//
+// Basic Usage:
+//
+//	client, err := awn.GetRealtimeData(ctx, funcData, "")
+//	defer client.Close()
+//	for record := range client.Data() {
+//		fmt.Println(record.MacAddress, record.Tempf)
+//	}
+func GetRealtimeData(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	opts ...RealtimeOption) (*RealtimeClient, error) {
+	err := funcData.validateKeys()
+	if err != nil {
+		getLogger().Error("invalid function data", "error", err)
+		return nil, err
+	}
+
+	options := newRealtimeOptions(opts)
 
-		err = wsjson.Write(ctx, c, "hi")
+	config, err := realtimeConfig(url, funcData.App, options.userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	client := &RealtimeClient{ //nolint:exhaustruct
+		config:     config,
+		keys:       funcData.apiKeys(),
+		options:    options,
+		data:       make(chan RealtimeRecord),
+		status:     make(chan RealtimeStatus, realtimeStatusBuffer),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		deviceKeys: make(map[string]string),
+		muted:      make(map[string]struct{}),
+	}
+
+	conn, session, err := client.connect(ctx)
+	if err != nil {
+		cancel()
+		getLogger().Error("unable to connect to the realtime api", "error", err)
+		return nil, err
+	}
+
+	go client.run(ctx, conn, session)
+
+	return client, nil
+}
+
+// realtimeConfig is a private helper function that builds the WebSocket configuration
+// for the Socket.IO endpoint under base, which defaults to baseURLRealtime, with the
+// given User-Agent header.
+func realtimeConfig(base string, appKey string, userAgent string) (*websocket.Config, error) {
+	if base == "" {
+		base = baseURLRealtime
+	}
+
+	location, err := url.Parse(strings.TrimSuffix(base, "/") + realtimePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid realtime url: %w", err)
+	}
+
+	query := location.Query()
+	query.Set("api", "1")
+	query.Set("applicationKey", appKey)
+	query.Set("EIO", "3")
+	query.Set("transport", "websocket")
+	location.RawQuery = query.Encode()
+
+	origin := url.URL{Scheme: "https", Host: location.Host} //nolint:exhaustruct
+	if location.Scheme == "ws" {
+		origin.Scheme = "http"
+	}
+
+	config, err := websocket.NewConfig(location.String(), origin.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid realtime url: %w", err)
+	}
+
+	config.Dialer = &net.Dialer{Timeout: defaultCtxTimeout * time.Second} //nolint:exhaustruct
+	config.Header = http.Header{"User-Agent": {userAgent}}
+
+	return config, nil
+}
+
+// run is a private method that serves the connection and opens it again each time that
+// it drops, until ctx is done or the reconnection attempts run out. It closes both
+// channels, and then done, when it returns.
+func (c *RealtimeClient) run(ctx context.Context, conn *websocket.Conn, session engineSession) {
+	defer close(c.done)
+	defer c.cancel()
+	defer close(c.status)
+	defer close(c.data)
+
+	for {
+		c.setStatus(RealtimeStatus{State: Connected, Attempt: 0, Err: nil})
+
+		err := c.serve(ctx, conn, session)
+
+		conn, session, err = c.reconnect(ctx, err)
+		if err != nil {
+			c.setStatus(RealtimeStatus{State: Disconnected, Attempt: 0, Err: err})
+			return
+		}
+	}
+}
+
+// reconnect is a private method that waits, with a backoff, and connects again until it
+// succeeds, ctx is done or the reconnection attempts run out. cause is the error that
+// dropped the connection.
+func (c *RealtimeClient) reconnect(ctx context.Context, cause error) (*websocket.Conn, engineSession, error) {
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			return nil, engineSession{}, ctx.Err()
+		}
+
+		if c.options.maxReconnects >= 0 && attempt > c.options.maxReconnects {
+			return nil, engineSession{}, fmt.Errorf("gave up after %v reconnection attempts: %w", attempt-1, cause)
+		}
+
+		getLogger().Warn("realtime connection dropped, reconnecting", "attempt", attempt, "error", cause)
+		c.setStatus(RealtimeStatus{State: Reconnecting, Attempt: attempt, Err: cause})
+
+		select {
+		case <-ctx.Done():
+			return nil, engineSession{}, ctx.Err()
+		case <-time.After(c.options.backoff(attempt)):
+		}
+
+		conn, session, err := c.connect(ctx)
+		if err == nil {
+			return conn, session, nil
+		}
+
+		cause = err
+	}
+}
+
+// setConn is a private method that sets the connection that Subscribe and Unsubscribe
+// send their commands on, or clears it when conn is nil.
+func (c *RealtimeClient) setConn(conn *websocket.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = conn
+}
+
+// setStatus is a private method that sends status on the status channel without
+// blocking. If the channel is full, the status is dropped.
+func (c *RealtimeClient) setStatus(status RealtimeStatus) {
+	select {
+	case c.status <- status:
+	default:
+		getLogger().Warn("realtime status channel is full, dropping status", "state", status.State)
+	}
+}
+
+// connect is a private method that opens a connection, waits for the Socket.IO
+// handshake and subscribes with every API key that was not unsubscribed.
+func (c *RealtimeClient) connect(ctx context.Context) (*websocket.Conn, engineSession, error) {
+	conn, err := websocket.DialConfig(c.config)
+	if err != nil {
+		return nil, engineSession{}, fmt.Errorf("unable to connect to the realtime api: %w", err)
+	}
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	session, err := handshake(conn)
+	if err == nil {
+		c.mu.Lock()
+		keys := slices.Clone(c.keys)
+		c.mu.Unlock()
+
+		if len(keys) > 0 {
+			err = sendEvent(conn, "subscribe", map[string][]string{"apiKeys": keys})
+		}
+	}
+
+	if err != nil {
+		_ = conn.Close()
+
+		if ctx.Err() != nil {
+			return nil, engineSession{}, ctx.Err()
+		}
+
+		return nil, engineSession{}, err
+	}
+
+	getLogger().Info("connected to the realtime api", "url", c.config.Location.Redacted())
+
+	return conn, session, nil
+}
+
+// handshake is a private function that reads the Engine.IO open packet and waits for the
+// Socket.IO connect packet. It returns the keepalive timings of the server.
+func handshake(conn *websocket.Conn) (engineSession, error) {
+	session := engineSession{PingInterval: defaultPingInterval, PingTimeout: defaultPingTimeout}
+
+	_ = conn.SetReadDeadline(time.Now().Add(defaultCtxTimeout * time.Second))
+
+	for {
+		var packet string
+
+		err := websocket.Message.Receive(conn, &packet)
 		if err != nil {
-			// ...
+			return engineSession{}, fmt.Errorf("realtime handshake failed: %w", err)
 		}
 
-		c.Close(websocket.StatusNormalClosure, "")
+		switch {
+		case packet == socketConnect:
+			return session, nil
+		case strings.HasPrefix(packet, engineOpen):
+			err = json.Unmarshal([]byte(packet[len(engineOpen):]), &session)
+			if err != nil {
+				return engineSession{}, fmt.Errorf("realtime handshake failed: %w", err)
+			}
+		case packet == engineClose:
+			return engineSession{}, errRealtimeClosed
+		}
+	}
+}
+
+// serve is a private method that reads from the connection until it drops or ctx is
+// done, sending each reading on the data channel and pinging the server to keep the
+// connection alive.
+func (c *RealtimeClient) serve(ctx context.Context, conn *websocket.Conn, session engineSession) error {
+	done := make(chan struct{})
+	defer close(done)
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	c.setConn(conn)
+	defer c.setConn(nil)
+
+	pingInterval := time.Duration(session.PingInterval) * time.Millisecond
+	pingTimeout := time.Duration(session.PingTimeout) * time.Millisecond
+
+	go keepalive(conn, pingInterval, done)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(pingInterval + pingTimeout))
+
+		var packet string
+
+		err := websocket.Message.Receive(conn, &packet)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return fmt.Errorf("realtime connection dropped: %w", err)
+		}
+
+		switch {
+		case packet == engineClose || packet == socketDisconnect:
+			return errRealtimeClosed
+		case packet == enginePing:
+			_ = websocket.Message.Send(conn, enginePong)
+		case strings.HasPrefix(packet, socketEvent):
+			err = c.handleEvent(ctx, packet[len(socketEvent):])
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleEvent is a private method that handles a single Socket.IO event. Readings are
+// sent on the data channel, the devices of a subscription are kept for
+// SubscribedDevices, and anything that cannot be decoded is logged and skipped.
+// It only returns an error when ctx is done.
+func (c *RealtimeClient) handleEvent(ctx context.Context, payload string) error {
+	var event []json.RawMessage
+
+	var name string
+
+	err := json.Unmarshal([]byte(payload), &event)
+	if err == nil && len(event) > 0 {
+		err = json.Unmarshal(event[0], &name)
+	}
+
+	if err != nil || len(event) == 0 {
+		getLogger().Warn("skipping malformed realtime event", "event", payload, "error", err)
+		return nil
+	}
+
+	switch name {
+	case "data":
+		if len(event) < 2 { //nolint:gomnd
+			return nil
+		}
+
+		var record RealtimeRecord
+
+		err = json.Unmarshal(event[1], &record)
+		if err != nil {
+			getLogger().Warn("skipping malformed realtime record", "error", err)
+			return nil
+		}
+
+		c.mu.Lock()
+		muted := c.isMuted(record.MacAddress)
+		c.mu.Unlock()
+
+		if muted {
+			return nil
+		}
+
+		select {
+		case c.data <- record:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case "subscribed":
+		if len(event) < 2 { //nolint:gomnd
+			return nil
+		}
+
+		var subscribed struct {
+			Devices AmbientDevice `json:"devices"`
+		}
+
+		var keys struct {
+			Devices []struct {
+				MacAddress string `json:"macAddress"`
+				APIKey     string `json:"apiKey"`
+			} `json:"devices"`
+		}
+
+		err = json.Unmarshal(event[1], &subscribed)
+		if err == nil {
+			err = json.Unmarshal(event[1], &keys)
+		}
+
+		if err != nil {
+			getLogger().Warn("skipping malformed realtime subscription", "error", err)
+			return nil
+		}
+
+		getLogger().Info("subscribed to the realtime api", "devices", len(subscribed.Devices))
+
+		c.mu.Lock()
+		c.devices = subscribed.Devices
+
+		// the keys are kept after a key is unsubscribed, so that Subscribe can find them
+		for _, device := range keys.Devices {
+			mac, err := NormalizeMacAddress(device.MacAddress)
+			if err == nil && device.APIKey != "" {
+				c.deviceKeys[mac] = device.APIKey
+			}
+		}
+		c.mu.Unlock()
+	default:
+		getLogger().Debug("ignoring realtime event", "event", name)
+	}
+
+	return nil
+}
+
+// keepalive is a private function that pings the server every interval until done is
+// closed or a ping cannot be sent.
+func keepalive(conn *websocket.Conn, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := websocket.Message.Send(conn, enginePing)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendEvent is a private function that sends a Socket.IO event with the given name and
+// payload.
+func sendEvent(conn *websocket.Conn, name string, payload any) error {
+	frame, err := json.Marshal([]any{name, payload})
+	if err != nil {
+		return fmt.Errorf("unable to encode realtime event: %w", err)
+	}
 
-	*/
-	url := baseURLRealtime + apiVersionRealtime
+	err = websocket.Message.Send(conn, socketEvent+string(frame))
+	if err != nil {
+		return fmt.Errorf("unable to send realtime event: %w", err)
+	}
 
-	return url, nil
+	return nil
 }
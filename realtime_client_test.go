@@ -0,0 +1,438 @@
+package awn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// realtimeServer is a mock of the real-time API. Each connection runs the Socket.IO
+// handshake, records the subscribe event and hands the connection, along with its
+// number, to serve. Once refuseAfter connections have been served, the rest are closed
+// before the handshake.
+type realtimeServer struct {
+	mu          sync.Mutex
+	count       int
+	refuseAfter int
+	subscribes  []string
+}
+
+// start is a helper method that starts the mock server and returns its ws:// URL.
+func (m *realtimeServer) start(t *testing.T, serve func(ws *websocket.Conn, n int)) string {
+	t.Helper()
+
+	s := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		m.mu.Lock()
+		m.count++
+		n := m.count
+		refused := m.refuseAfter > 0 && n > m.refuseAfter
+		m.mu.Unlock()
+
+		if refused {
+			return
+		}
+
+		_ = websocket.Message.Send(ws, `0{"sid":"abc","pingInterval":25000,"pingTimeout":5000}`)
+		_ = websocket.Message.Send(ws, socketConnect)
+
+		var subscribe string
+		if err := websocket.Message.Receive(ws, &subscribe); err != nil {
+			return
+		}
+
+		m.mu.Lock()
+		m.subscribes = append(m.subscribes, subscribe)
+		m.mu.Unlock()
+
+		serve(ws, n)
+	}))
+	t.Cleanup(s.Close)
+
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// sendReading is a helper function that pushes a reading with the given temperature.
+func sendReading(ws *websocket.Conn, tempf int) {
+	_ = websocket.Message.Send(ws,
+		fmt.Sprintf(`42["data",{"macAddress":"00:11:22:33:44:55","dateutc":1697142300000,"tempf":%d}]`, tempf))
+}
+
+// drain is a helper function that reads from ws until the client closes it.
+func drain(ws *websocket.Conn) {
+	var packet string
+	for websocket.Message.Receive(ws, &packet) == nil {
+	}
+}
+
+// nextStatus is a helper function that waits for the next RealtimeStatus.
+func nextStatus(t *testing.T, status <-chan RealtimeStatus) RealtimeStatus {
+	t.Helper()
+
+	select {
+	case got, ok := <-status:
+		if !ok {
+			t.Fatal("status channel closed early")
+		}
+		return got
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a status")
+	}
+
+	return RealtimeStatus{}
+}
+
+func TestGetRealtimeDataReconnects(t *testing.T) {
+	t.Parallel()
+	server := &realtimeServer{}
+	url := server.start(t, func(ws *websocket.Conn, n int) {
+		_ = websocket.Message.Send(ws, `42["subscribed",{"devices":[]}]`)
+		sendReading(ws, 70+n)
+		if n == 1 {
+			return // drop the first connection
+		}
+		drain(ws)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fd := FunctionData{API: "api", App: "app"}
+	client, err := GetRealtimeData(ctx, fd, url, WithReconnectWait(time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("GetRealtimeData() error = %v", err)
+	}
+	data, status := client.Data(), client.Status()
+
+	for _, want := range []int{71, 72} {
+		select {
+		case got := <-data:
+			if got.Tempf != float64(want) || got.MacAddress != "00:11:22:33:44:55" {
+				t.Errorf("GetRealtimeData() record = %+v, want tempf %v from 00:11:22:33:44:55", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the reading with tempf %v", want)
+		}
+	}
+
+	for _, want := range []ConnectionState{Connected, Reconnecting, Connected} {
+		if got := nextStatus(t, status); got.State != want {
+			t.Errorf("GetRealtimeData() status = %v, want %v", got.State, want)
+		}
+	}
+
+	cancel()
+	if got := nextStatus(t, status); got.State != Disconnected || !errors.Is(got.Err, context.Canceled) {
+		t.Errorf("GetRealtimeData() status = %v (%v), want %v", got.State, got.Err, Disconnected)
+	}
+	if _, ok := <-data; ok {
+		t.Error("GetRealtimeData() data channel is still open after cancel")
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	want := `42["subscribe",{"apiKeys":["api"]}]`
+	if len(server.subscribes) != 2 || server.subscribes[0] != want || server.subscribes[1] != want {
+		t.Errorf("GetRealtimeData() subscribed with %v, want %v twice", server.subscribes, want)
+	}
+}
+
+func TestGetRealtimeDataUserAgent(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		opts []RealtimeOption
+		want string
+	}{
+		{"TestDefault", nil, defaultUserAgent()},
+		{"TestEmpty", []RealtimeOption{WithRealtimeUserAgent("")}, defaultUserAgent()},
+		{"TestCustom", []RealtimeOption{WithRealtimeUserAgent("my-integration/1.0")}, "my-integration/1.0"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			server := &realtimeServer{}
+			userAgents := make(chan string, 1)
+			url := server.start(t, func(ws *websocket.Conn, _ int) {
+				userAgents <- ws.Request().Header.Get("User-Agent")
+				drain(ws)
+			})
+
+			client, err := GetRealtimeData(context.Background(), FunctionData{API: "api", App: "app"}, url, tt.opts...)
+			if err != nil {
+				t.Fatalf("GetRealtimeData() error = %v", err)
+			}
+			defer client.Close()
+
+			select {
+			case got := <-userAgents:
+				if got != tt.want {
+					t.Errorf("User-Agent = %v, want %v", got, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the handshake")
+			}
+		})
+	}
+}
+
+func TestGetRealtimeDataMaxReconnects(t *testing.T) {
+	t.Parallel()
+	server := &realtimeServer{refuseAfter: 1}
+	url := server.start(t, func(*websocket.Conn, int) {}) // drop the only connection
+
+	fd := FunctionData{API: "api", App: "app"}
+	client, err := GetRealtimeData(context.Background(), fd, url,
+		WithMaxReconnects(2), WithReconnectWait(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatalf("GetRealtimeData() error = %v", err)
+	}
+
+	var states []ConnectionState
+	var last RealtimeStatus
+	for got := range client.Status() {
+		states = append(states, got.State)
+		last = got
+	}
+
+	want := []ConnectionState{Connected, Reconnecting, Reconnecting, Disconnected}
+	if fmt.Sprint(states) != fmt.Sprint(want) || last.Err == nil {
+		t.Errorf("GetRealtimeData() states = %v, want %v with an error", states, want)
+	}
+}
+
+func TestGetRealtimeDataErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		fd   FunctionData
+		url  string
+		want error
+	}{
+		{"TestMissingAPIKey", FunctionData{App: "app"}, "ws://127.0.0.1:1", ErrAPIKeyMissing},
+		{"TestMissingAppKey", FunctionData{API: "api"}, "ws://127.0.0.1:1", ErrAppKeyMissing},
+		{"TestUnreachable", FunctionData{API: "api", App: "app"}, "ws://127.0.0.1:1", nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := GetRealtimeData(context.Background(), tt.fd, tt.url)
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("GetRealtimeData() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealtimeClose(t *testing.T) {
+	t.Parallel()
+	released := make(chan struct{})
+	server := &realtimeServer{}
+	url := server.start(t, func(ws *websocket.Conn, _ int) {
+		sendReading(ws, 70)
+		drain(ws)
+		close(released)
+	})
+
+	client, err := GetRealtimeData(context.Background(), FunctionData{API: "api", App: "app"}, url)
+	if err != nil {
+		t.Fatalf("GetRealtimeData() error = %v", err)
+	}
+
+	// the reading is never received, so Close must not wait on the consumer
+	for i := 0; i < 2; i++ {
+		if err := client.Close(); err != nil {
+			t.Errorf("Close() call %v error = %v", i+1, err)
+		}
+	}
+
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not close the socket")
+	}
+
+	for record := range client.Data() {
+		t.Errorf("Close() left a reading on the data channel: %+v", record)
+	}
+
+	var last RealtimeStatus
+	for status := range client.Status() {
+		last = status
+	}
+	if last.State != Disconnected {
+		t.Errorf("Close() last status = %v, want %v", last.State, Disconnected)
+	}
+}
+
+// subscribedPayload is a subscribed event as sent by the real-time API, for two weather
+// stations.
+const subscribedPayload = `42["subscribed",{"method":"subscribe","devices":[
+	{"macAddress":"00:11:22:33:44:55","lastData":{"dateutc":1697142300000,"tempf":85.8,"humidity":79,
+		"tz":"America/Chicago","date":"2023-10-12T20:25:00.000Z"},
+	"info":{"name":"Backyard","coords":{"coords":{"lat":30.2672,"lon":-97.7431},
+		"address":"Austin, TX, USA","location":"Austin","elevation":149.3,
+		"geo":{"type":"Point","coordinates":[-97.7431,30.2672]}}},"apiKey":"api"},
+	{"macAddress":"66:77:88:99:AA:BB","lastData":{"dateutc":1697142300000,"tempf":72.1},
+	"info":{"name":"Cabin","coords":{"coords":{"lat":39.7392,"lon":-104.9903},"location":"Denver"}},"apiKey":"api"}
+]}]`
+
+func TestRealtimeSubscribedDevices(t *testing.T) {
+	t.Parallel()
+	server := &realtimeServer{}
+	url := server.start(t, func(ws *websocket.Conn, _ int) {
+		_ = websocket.Message.Send(ws, subscribedPayload)
+		sendReading(ws, 70)
+		drain(ws)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := GetRealtimeData(ctx, FunctionData{API: "api", App: "app"}, url)
+	if err != nil {
+		t.Fatalf("GetRealtimeData() error = %v", err)
+	}
+
+	// the roster is known by the time the first reading arrives
+	select {
+	case <-client.Data():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a reading")
+	}
+
+	want := []StationLocation{
+		{Address: "Austin, TX, USA", Elevation: 149.3, Latitude: 30.2672, Location: "Austin",
+			Longitude: -97.7431, MacAddress: "00:11:22:33:44:55", Name: "Backyard"},
+		{Latitude: 39.7392, Location: "Denver", Longitude: -104.9903, MacAddress: "66:77:88:99:AA:BB",
+			Name: "Cabin"},
+	}
+	if got := client.SubscribedDevices(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SubscribedDevices() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRealtimeBackoff(t *testing.T) {
+	t.Parallel()
+	options := newRealtimeOptions(nil)
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, retryMinWaitTimeSeconds * time.Second},
+		{2, 2 * retryMinWaitTimeSeconds * time.Second},
+		{100, retryMaxWaitTimeSeconds * time.Second},
+	}
+	for _, tt := range tests {
+		if got := options.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%v) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRealtimeSubscribeUnsubscribe(t *testing.T) {
+	t.Parallel()
+	frames := make(chan string, 8)
+	send := make(chan string, 8)
+	server := &realtimeServer{}
+	url := server.start(t, func(ws *websocket.Conn, _ int) {
+		_ = websocket.Message.Send(ws, `42["subscribed",{"devices":[
+			{"macAddress":"00:11:22:33:44:55","apiKey":"api"},
+			{"macAddress":"66:77:88:99:AA:BB","apiKey":"api2"}]}]`)
+		sendReading(ws, 70)
+		go func() {
+			for packet := range send {
+				_ = websocket.Message.Send(ws, packet)
+			}
+		}()
+		var packet string
+		for websocket.Message.Receive(ws, &packet) == nil {
+			if packet != enginePing {
+				frames <- packet
+			}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fd := FunctionData{API: "api", App: "app", APIKeys: []string{"api2"}}
+	client, err := GetRealtimeData(ctx, fd, url)
+	if err != nil {
+		t.Fatalf("GetRealtimeData() error = %v", err)
+	}
+
+	nextRecord := func() RealtimeRecord {
+		t.Helper()
+		select {
+		case record := <-client.Data():
+			return record
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a reading")
+		}
+		return RealtimeRecord{}
+	}
+	nextFrame := func() string {
+		t.Helper()
+		select {
+		case frame := <-frames:
+			return frame
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a command")
+		}
+		return ""
+	}
+
+	// the roster is known by the time the first reading arrives
+	nextRecord()
+
+	if err := client.Unsubscribe("not-a-mac"); !errors.Is(err, ErrMalformedMacAddress) {
+		t.Errorf("Unsubscribe() error = %v, want %v", err, ErrMalformedMacAddress)
+	}
+
+	// the only station of api2 is dropped, so the key is unsubscribed
+	if err := client.Unsubscribe("66-77-88-99-aa-bb"); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+	if got, want := nextFrame(), `42["unsubscribe",{"apiKeys":["api2"]}]`; got != want {
+		t.Errorf("Unsubscribe() sent %v, want %v", got, want)
+	}
+	if got := client.SubscribedDevices(); len(got) != 1 || got[0].MacAddress != "00:11:22:33:44:55" {
+		t.Errorf("SubscribedDevices() = %+v, want only 00:11:22:33:44:55", got)
+	}
+
+	// a reading that was already in flight is dropped
+	send <- `42["data",{"macAddress":"66:77:88:99:AA:BB","dateutc":1697142300000,"tempf":60}]`
+	send <- `42["data",{"macAddress":"00:11:22:33:44:55","dateutc":1697142300000,"tempf":71}]`
+	if got := nextRecord(); got.MacAddress != "00:11:22:33:44:55" || got.Tempf != 71 {
+		t.Errorf("Unsubscribe() let through %+v, want the reading with tempf 71", got)
+	}
+
+	if err := client.Subscribe("66:77:88:99:AA:BB"); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if got, want := nextFrame(), `42["subscribe",{"apiKeys":["api2"]}]`; got != want {
+		t.Errorf("Subscribe() sent %v, want %v", got, want)
+	}
+
+	// subscribing again sends nothing, so the next command is the unsubscribe of api
+	if err := client.Subscribe("66:77:88:99:AA:BB"); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := client.Unsubscribe("00:11:22:33:44:55"); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+	if got, want := nextFrame(), `42["unsubscribe",{"apiKeys":["api"]}]`; got != want {
+		t.Errorf("Unsubscribe() sent %v, want %v", got, want)
+	}
+	close(send)
+}
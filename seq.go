@@ -0,0 +1,110 @@
+//go:build go1.23
+
+package awn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+)
+
+// HistoricalDataSeq is a public function that works like GetHistoricalData, but returns
+// an iterator that yields one WeatherRecord at a time, as each page arrives, instead of
+// holding every record in memory until the end. The next page is only fetched once every
+// record of the current page has been yielded, so breaking out of the loop stops any
+// more calls to the API. If a call fails, including when ctx ends, the error is yielded
+// once, with an empty WeatherRecord, and the iteration stops. It requires Go 1.23 or
+// newer.
+//
+// Basic Usage:
+//
+//	for record, err := range awn.HistoricalDataSeq(ctx, *apiConfig, url, version) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(record.Date, record.Tempf)
+//	}
+func HistoricalDataSeq(
+	ctx context.Context,
+	funcData FunctionData,
+	url string,
+	version string,
+	opts ...Option) iter.Seq2[WeatherRecord, error] {
+	return func(yield func(WeatherRecord, error) bool) {
+		options := newFetchOptions(opts)
+
+		client, err := CreateAwnClientWithOptions(url, version, options.clientOptions)
+		if err != nil {
+			getLogger().Error("unable to create client", "url", url+version, "error", err)
+			yield(WeatherRecord{}, fmt.Errorf("unable to create client: %w", err)) //nolint:exhaustruct
+			return
+		}
+
+		stopped := false
+
+		err = fetchPages(ctx, client, funcData, funcData.Epoch, options.clock.Now().UnixMilli(), options,
+			func(page DeviceDataResponse) bool {
+				for _, record := range page {
+					if !yield(record, nil) {
+						stopped = true
+						return false
+					}
+				}
+
+				return true
+			})
+		if err != nil && !stopped {
+			getLogger().Error("unable to get device data", "endpoint", devicesEndpoint, "mac", funcData.Mac,
+				"error", err)
+			yield(WeatherRecord{}, fmt.Errorf("unable to get device data: %w", err)) //nolint:exhaustruct
+		}
+	}
+}
+
+// WriteNDJSON is a public function that writes the weather records yielded by records to w
+// as newline-delimited JSON, with one compact object per line. Each line is written to w
+// in a single call as soon as its record is yielded, and w is flushed after it when it is
+// an http.Flusher, so large exports are streamed rather than held in memory. If a record
+// cannot be encoded or w fails, the iteration stops and the error is returned, leaving
+// every line written before it whole.
+//
+// Basic Usage:
+//
+//	records := func(yield func(awn.WeatherRecord) bool) {
+//		for record, err := range awn.HistoricalDataSeq(ctx, *apiConfig, url, version) {
+//			if err != nil || !yield(record) {
+//				return
+//			}
+//		}
+//	}
+//	err = awn.WriteNDJSON(os.Stdout, records)
+func WriteNDJSON(w io.Writer, records iter.Seq[WeatherRecord]) error {
+	flusher, _ := w.(http.Flusher)
+
+	var err error
+
+	for record := range records {
+		var line []byte
+
+		line, err = json.Marshal(record)
+		if err != nil {
+			err = fmt.Errorf("unable to encode record: %w", err)
+			break
+		}
+
+		_, err = w.Write(append(line, '\n'))
+		if err != nil {
+			err = fmt.Errorf("unable to write ndjson: %w", err)
+			break
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	return err
+}
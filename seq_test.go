@@ -0,0 +1,172 @@
+//go:build go1.23
+
+package awn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHistoricalDataSeq(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		stopAfter    int
+		wantRecords  int
+		wantRequests int32
+	}{
+		// 6 records in pages of 2, so the last page is followed by an empty one
+		{"TestFullConsumption", 0, 6, 4},
+		{"TestBreakMidPage", 3, 3, 2},
+		{"TestBreakAfterFirstRecord", 1, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var requests int32
+			records := pagedHandler(recentRecords(6, time.Hour), false)
+			s := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					records(w, r)
+				}))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			fd := FunctionData{
+				API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55",
+				Epoch: time.Now().Add(-72 * time.Hour).UnixMilli(),
+			}
+
+			count := 0
+			var previous int64
+			for record, err := range HistoricalDataSeq(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions())) {
+				if err != nil {
+					t.Fatalf("HistoricalDataSeq() error = %v", err)
+				}
+				if previous != 0 && record.Dateutc >= previous {
+					t.Errorf("HistoricalDataSeq() yielded %v after %v, want newest first", record.Dateutc, previous)
+				}
+				previous = record.Dateutc
+				count++
+				if count == tt.stopAfter {
+					break
+				}
+			}
+
+			if count != tt.wantRecords {
+				t.Errorf("HistoricalDataSeq() yielded %v records, want %v", count, tt.wantRecords)
+			}
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("server received %v requests, want %v", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestHistoricalDataSeqCancelled(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(pagedHandler(recentRecords(6, time.Hour), false))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fd := FunctionData{
+		API: "api", App: "app", Limit: 2, Mac: "00:11:22:33:44:55",
+		Epoch: time.Now().Add(-72 * time.Hour).UnixMilli(),
+	}
+
+	count := 0
+	var errs []error
+	for _, err := range HistoricalDataSeq(ctx, fd, s.URL, "/v1", WithClientOptions(testClientOptions())) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		count++
+		// cancel once the first page has been received
+		if count == 2 {
+			cancel()
+		}
+	}
+
+	if count != 2 {
+		t.Errorf("HistoricalDataSeq() yielded %v records, want 2", count)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrContextTimeoutExceeded) {
+		t.Errorf("HistoricalDataSeq() errors = %v, want a single %v", errs, ErrContextTimeoutExceeded)
+	}
+}
+
+// failingWriter is an io.Writer that fails every write after the first n.
+type failingWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	f.n--
+
+	return f.Buffer.Write(p)
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	t.Parallel()
+	records := Flatten(exportData())
+	var lines []string
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		lines = append(lines, string(line))
+	}
+	bad := records[0]
+	bad.Tempf = math.NaN()
+
+	tests := []struct {
+		name    string
+		records []WeatherRecord
+		writes  int
+		want    []string
+		wantErr bool
+	}{
+		{"TestAllRecords", records, -1, lines, false},
+		{"TestNoRecords", nil, -1, nil, false},
+		{"TestEncodeErrorMidStream", []WeatherRecord{records[0], bad, records[1]}, -1, lines[:1], true},
+		{"TestWriteErrorMidStream", records, 1, lines[:1], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := &failingWriter{n: tt.writes}
+			err := WriteNDJSON(w, slices.Values(tt.records))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteNDJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := ""
+			if len(tt.want) > 0 {
+				want = strings.Join(tt.want, "\n") + "\n"
+			}
+			if got := w.String(); got != want {
+				t.Errorf("WriteNDJSON() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package awn
+
+import "math"
+
+// StatsOption is a functional option that changes how Stats and its wrappers, such as
+// TempStats, summarize the records.
+type StatsOption func(*statsOptions)
+
+// statsOptions is a private struct that holds the values that are set by each
+// StatsOption.
+type statsOptions struct {
+	skipZero bool
+}
+
+// SkipZeroReadings is a public function that returns a StatsOption that leaves out every
+// reading that is exactly zero. A sensor that is missing or did not report leaves its
+// fields at zero, which would otherwise drag the minimum and the mean down.
+//
+// Basic Usage:
+//
+//	low, high, mean := awn.TempStats(records, awn.SkipZeroReadings())
+func SkipZeroReadings() StatsOption {
+	return func(o *statsOptions) {
+		o.skipZero = true
+	}
+}
+
+// Stats is a public function that returns the minimum, maximum and mean of the value
+// that field returns for each record. When there are no readings to summarize, because
+// records is empty or every reading was skipped, all three values are NaN, which can be
+// checked with math.IsNaN.
+//
+// Basic Usage:
+//
+//	low, high, mean := awn.Stats(records, func(w awn.WeatherRecord) float64 {
+//		return w.Baromrelin
+//	})
+func Stats(
+	records []WeatherRecord,
+	field func(WeatherRecord) float64,
+	opts ...StatsOption) (float64, float64, float64) {
+	options := statsOptions{skipZero: false}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	low, high, sum, count := math.Inf(1), math.Inf(-1), 0.0, 0
+
+	for _, record := range records {
+		value := field(record)
+		if options.skipZero && value == 0 {
+			continue
+		}
+
+		low = math.Min(low, value)
+		high = math.Max(high, value)
+		sum += value
+		count++
+	}
+
+	if count == 0 {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+
+	return low, high, sum / float64(count)
+}
+
+// TempStats is a public function that returns the minimum, maximum and mean outdoor
+// temperature (Tempf) of the records, in degrees Fahrenheit. See Stats.
+//
+// Basic Usage:
+//
+//	low, high, mean := awn.TempStats(records)
+func TempStats(records []WeatherRecord, opts ...StatsOption) (float64, float64, float64) {
+	return Stats(records, func(w WeatherRecord) float64 { return w.Tempf }, opts...)
+}
+
+// HumidityStats is a public function that returns the minimum, maximum and mean outdoor
+// relative humidity of the records, as a percentage. See Stats.
+//
+// Basic Usage:
+//
+//	low, high, mean := awn.HumidityStats(records)
+func HumidityStats(records []WeatherRecord, opts ...StatsOption) (float64, float64, float64) {
+	return Stats(records, func(w WeatherRecord) float64 { return float64(w.Humidity) }, opts...)
+}
+
+// WindStats is a public function that returns the minimum, maximum and mean wind speed
+// (Windspeedmph) of the records, in miles per hour. See Stats.
+//
+// Basic Usage:
+//
+//	low, high, mean := awn.WindStats(records)
+func WindStats(records []WeatherRecord, opts ...StatsOption) (float64, float64, float64) {
+	return Stats(records, func(w WeatherRecord) float64 { return w.Windspeedmph }, opts...)
+}
@@ -0,0 +1,65 @@
+package awn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+	records := []WeatherRecord{
+		{Tempf: 68.5, Humidity: 40, Windspeedmph: 3.5},
+		{Tempf: 72.1, Humidity: 0, Windspeedmph: 0},
+		{Tempf: 70.3, Humidity: 50, Windspeedmph: 8},
+		{Tempf: 65.1, Humidity: 45, Windspeedmph: 1.5},
+	}
+
+	type stats func([]WeatherRecord, ...StatsOption) (float64, float64, float64)
+	tests := []struct {
+		name     string
+		stats    stats
+		opts     []StatsOption
+		wantLow  float64
+		wantHigh float64
+		wantMean float64
+	}{
+		{"TestTempStats", TempStats, nil, 65.1, 72.1, 69},
+		{"TestHumidityStats", HumidityStats, nil, 0, 50, 33.75},
+		{"TestHumidityStatsSkipZero", HumidityStats, []StatsOption{SkipZeroReadings()}, 40, 50, 45},
+		{"TestWindStats", WindStats, nil, 0, 8, 3.25},
+		{"TestWindStatsSkipZero", WindStats, []StatsOption{SkipZeroReadings()}, 1.5, 8, 13.0 / 3},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			low, high, mean := tt.stats(records, tt.opts...)
+			if low != tt.wantLow || high != tt.wantHigh || math.Abs(mean-tt.wantMean) > 1e-9 {
+				t.Errorf("Stats() = %v, %v, %v, want %v, %v, %v",
+					low, high, mean, tt.wantLow, tt.wantHigh, tt.wantMean)
+			}
+		})
+	}
+}
+
+func TestStatsNoReadings(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		records []WeatherRecord
+	}{
+		{"TestNil", nil},
+		{"TestEmpty", []WeatherRecord{}},
+		{"TestAllSkipped", []WeatherRecord{{Tempf: 0}, {Tempf: 0}}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			low, high, mean := TempStats(tt.records, SkipZeroReadings())
+			if !math.IsNaN(low) || !math.IsNaN(high) || !math.IsNaN(mean) {
+				t.Errorf("TempStats() = %v, %v, %v, want NaN, NaN, NaN", low, high, mean)
+			}
+		})
+	}
+}